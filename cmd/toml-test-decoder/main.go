@@ -69,6 +69,12 @@ func translate(tomlData interface{}) interface{} {
 		return typed
 	case time.Time:
 		return tag("datetime", orig.Format("2006-01-02T15:04:05.999999999Z07:00"))
+	case toml.LocalDatetime:
+		return tag("datetime-local", orig.String())
+	case toml.LocalDate:
+		return tag("date-local", orig.String())
+	case toml.LocalTime:
+		return tag("time-local", orig.String())
 	case bool:
 		return tag("bool", fmt.Sprintf("%v", orig))
 	case int64:
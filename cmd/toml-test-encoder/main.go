@@ -90,6 +90,24 @@ func untag(typed map[string]interface{}) interface{} {
 			log.Fatalf("Could not parse '%s' as a datetime: %s", v, err)
 		}
 		return t
+	case "datetime-local":
+		var dt toml.LocalDatetime
+		if err := dt.UnmarshalText([]byte(v.(string))); err != nil {
+			log.Fatalf("Could not parse '%s' as a local datetime: %s", v, err)
+		}
+		return dt
+	case "date-local":
+		var d toml.LocalDate
+		if err := d.UnmarshalText([]byte(v.(string))); err != nil {
+			log.Fatalf("Could not parse '%s' as a local date: %s", v, err)
+		}
+		return d
+	case "time-local":
+		var tm toml.LocalTime
+		if err := tm.UnmarshalText([]byte(v.(string))); err != nil {
+			log.Fatalf("Could not parse '%s' as a local time: %s", v, err)
+		}
+		return tm
 	case "bool":
 		v := v.(string)
 		switch v {
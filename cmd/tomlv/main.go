@@ -15,6 +15,7 @@ import (
 
 var (
 	flagTypes = false
+	flagSpec  = "1.0"
 )
 
 func init() {
@@ -22,6 +23,9 @@ func init() {
 
 	flag.BoolVar(&flagTypes, "types", flagTypes,
 		"When set, the types of every defined key will be shown.")
+	flag.StringVar(&flagSpec, "spec", flagSpec,
+		"The version of the TOML specification to validate against: "+
+			"0.4, 1.0, or 1.1 (the unreleased draft).")
 
 	flag.Usage = usage
 	flag.Parse()
@@ -39,10 +43,23 @@ func main() {
 	if flag.NArg() < 1 {
 		flag.Usage()
 	}
+	version, ok := map[string]toml.Version{
+		"0.4": toml.V0_4,
+		"1.0": toml.V1_0,
+		"1.1": toml.V1_1Draft,
+	}[flagSpec]
+	if !ok {
+		log.Fatalf("Unknown TOML version '%s'; must be 0.4, 1.0, or 1.1", flagSpec)
+	}
 	for _, f := range flag.Args() {
-		var tmp interface{}
-		md, err := toml.DecodeFile(f, &tmp)
+		md, err := decodeFile(f, version)
 		if err != nil {
+			if pErrs, ok := err.(toml.ParseErrors); ok {
+				for i := range pErrs {
+					pErrs[i].Filename = f
+				}
+				log.Fatalf("Errors in %s", pErrs.ErrorWithPosition())
+			}
 			log.Fatalf("Error in '%s': %s", f, err)
 		}
 		if flagTypes {
@@ -51,6 +68,20 @@ func main() {
 	}
 }
 
+func decodeFile(f string, version toml.Version) (toml.MetaData, error) {
+	fp, err := os.Open(f)
+	if err != nil {
+		return toml.MetaData{}, err
+	}
+	defer fp.Close()
+
+	dec := toml.NewDecoder(fp)
+	dec.SpecVersion(version)
+	dec.AllErrors()
+	var tmp interface{}
+	return dec.Decode(&tmp)
+}
+
 func printTypes(md toml.MetaData) {
 	tabw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	for _, key := range md.Keys() {
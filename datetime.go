@@ -0,0 +1,132 @@
+package toml
+
+import (
+	"fmt"
+	"time"
+)
+
+// Formats used for the local date and time types; these are also the formats
+// they're written in by the encoder.
+const (
+	localDatetimeFormat = "2006-01-02T15:04:05.999999999"
+	localDateFormat     = "2006-01-02"
+	localTimeFormat     = "15:04:05.999999999"
+)
+
+// LocalDate is a TOML local date (e.g. 1979-05-27): a date without a time or
+// any relation to an offset or timezone.
+type LocalDate struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// LocalTime is a TOML local time (e.g. 07:32:00.999): a time of day without
+// a date or any relation to an offset or timezone.
+type LocalTime struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+}
+
+// LocalDatetime is a TOML local datetime (e.g. 1979-05-27T07:32:00): a date
+// and time without any relation to an offset or timezone.
+type LocalDatetime struct {
+	Date LocalDate
+	Time LocalTime
+}
+
+// LocalDateOf returns the LocalDate in which t occurs, in t's location.
+func LocalDateOf(t time.Time) LocalDate {
+	var d LocalDate
+	d.Year, d.Month, d.Day = t.Date()
+	return d
+}
+
+// LocalTimeOf returns the LocalTime representing the time of day at which t
+// occurs, in t's location.
+func LocalTimeOf(t time.Time) LocalTime {
+	var tm LocalTime
+	tm.Hour, tm.Minute, tm.Second = t.Clock()
+	tm.Nanosecond = t.Nanosecond()
+	return tm
+}
+
+// LocalDatetimeOf returns the LocalDatetime at which t occurs, in t's
+// location.
+func LocalDatetimeOf(t time.Time) LocalDatetime {
+	return LocalDatetime{Date: LocalDateOf(t), Time: LocalTimeOf(t)}
+}
+
+// In returns the time.Time at midnight of the date in the given location.
+func (d LocalDate) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// In returns the time.Time for the time of day on 0000-01-01 in the given
+// location.
+func (t LocalTime) In(loc *time.Location) time.Time {
+	return time.Date(0, 1, 1, t.Hour, t.Minute, t.Second, t.Nanosecond, loc)
+}
+
+// In returns the time.Time for the date and time in the given location.
+func (dt LocalDatetime) In(loc *time.Location) time.Time {
+	return time.Date(dt.Date.Year, dt.Date.Month, dt.Date.Day,
+		dt.Time.Hour, dt.Time.Minute, dt.Time.Second, dt.Time.Nanosecond, loc)
+}
+
+// String returns the date in TOML format (e.g. 1979-05-27).
+func (d LocalDate) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// String returns the time in TOML format (e.g. 07:32:00.999); the fractional
+// seconds are omitted if they're zero.
+func (t LocalTime) String() string {
+	return t.In(time.UTC).Format(localTimeFormat)
+}
+
+// String returns the datetime in TOML format (e.g. 1979-05-27T07:32:00).
+func (dt LocalDatetime) String() string {
+	return dt.Date.String() + "T" + dt.Time.String()
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d LocalDate) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (t LocalTime) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (dt LocalDatetime) MarshalText() ([]byte, error) { return []byte(dt.String()), nil }
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *LocalDate) UnmarshalText(text []byte) error {
+	t, err := time.Parse(localDateFormat, string(text))
+	if err != nil {
+		return err
+	}
+	*d = LocalDateOf(t)
+	return nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (t *LocalTime) UnmarshalText(text []byte) error {
+	tt, err := time.Parse(localTimeFormat, string(text))
+	if err != nil {
+		return err
+	}
+	*t = LocalTimeOf(tt)
+	return nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (dt *LocalDatetime) UnmarshalText(text []byte) error {
+	t, err := time.Parse(localDatetimeFormat, datetimeRepl.Replace(string(text)))
+	if err != nil {
+		return err
+	}
+	*dt = LocalDatetimeOf(t)
+	return nil
+}
@@ -2,15 +2,27 @@ package toml
 
 import (
 	"encoding"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
+	"math/big"
+	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	numberType          = reflect.TypeOf(Number(""))
+	bigIntType          = reflect.TypeOf(big.Int{})
+	bigFloatType        = reflect.TypeOf(big.Float{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
 func e(format string, args ...interface{}) error {
 	return fmt.Errorf("toml: "+format, args...)
 }
@@ -21,6 +33,20 @@ type Unmarshaler interface {
 	UnmarshalTOML(interface{}) error
 }
 
+// Validator is the interface implemented by structs that can check themselves
+// after they're decoded from a TOML table, for example to check that one field
+// is smaller than another.
+//
+// ValidateTOML is called after all the fields are set, and after the
+// ValidateTOML method of the structs in the fields. It's also called for
+// structs with defaults from the struct tags if the table isn't in the
+// document. The MetaData can be used to check which keys are defined. The
+// error is returned from Decode as a DecodeError with the key and position of
+// the table.
+type Validator interface {
+	ValidateTOML(md MetaData) error
+}
+
 // Unmarshal decodes the contents of `p` in TOML format into a pointer `v`.
 func Unmarshal(p []byte, v interface{}) error {
 	_, err := Decode(string(p), v)
@@ -57,8 +83,12 @@ type Primitive struct {
 // update the undecoded keys in the meta data. (See the example.)
 func (md *MetaData) PrimitiveDecode(primValue Primitive, v interface{}) error {
 	md.context = primValue.context
+	md.missing = nil
 	defer func() { md.context = nil }()
-	return md.unify(primValue.undecoded, rvalue(v))
+	if err := md.unify(primValue.undecoded, rvalue(v)); err != nil {
+		return err
+	}
+	return md.missingFields()
 }
 
 // Decode will decode the contents of `data` in TOML format into a pointer
@@ -70,16 +100,25 @@ func (md *MetaData) PrimitiveDecode(primValue Primitive, v interface{}) error {
 // TOML arrays of tables correspond to either a slice of structs or a slice
 // of maps.
 //
-// TOML datetimes correspond to Go `time.Time` values.
+// TOML datetimes correspond to Go `time.Time` values. Local datetimes, local
+// dates and local times (which have no offset) correspond to the LocalDatetime,
+// LocalDate and LocalTime types; they are also loaded into a `time.Time` in
+// the local timezone if that's what the Go value is.
 //
 // All other TOML types (float, string, int, bool and array) correspond
-// to the obvious Go types.
+// to the obvious Go types. Integers and floats can also be decoded in to a
+// Number, which keeps the text exactly as it's written in the document.
+// Integers of any size can be decoded in to a big.Int, and integers and floats
+// in to a big.Float; unsigned integer types can hold up to their maximum value
+// (even though TOML integers are 64-bit signed), but not negative numbers.
 //
 // An exception to the above rules is if a type implements the
 // encoding.TextUnmarshaler interface. In this case, any primitive TOML value
 // (floats, strings, integers, booleans and datetimes) will be converted to
 // a byte string and given to the value's UnmarshalText method. See the
-// Unmarshaler example for a demonstration with time duration strings.
+// Unmarshaler example for a demonstration with time duration strings. Tables
+// and arrays are decoded as usual if the type is a struct, map, slice, or
+// array, so a type can be decoded from both a string and a table.
 //
 // Key mapping
 //
@@ -87,17 +126,267 @@ func (md *MetaData) PrimitiveDecode(primValue Primitive, v interface{}) error {
 // struct. The special `toml` struct tag may be used to map TOML keys to
 // struct fields that don't match the key name exactly. (See the example.)
 // A case insensitive match to struct names will be tried if an exact match
-// can't be found.
+// can't be found, unless the Decoder is CaseSensitive. It's an error if
+// several keys match the same field, such as "Name" and "name".
+//
+// Map keys can be strings, integers (which are parsed in base 10), or types
+// that implement encoding.TextUnmarshaler.
+//
+// Fields that aren't in the document are set to a default from the struct tag
+// if there is one, with a separate "default" tag or the "default=" option.
+// The default is a TOML value, so strings need quotes:
+//
+//	Host string   `toml:"host" default:"'localhost'"`
+//	Port int      `toml:"port,default=8080"`
+//	Tags []string `toml:"tags,default=['a', 'b']"`
+//
+// Fields with the "required" option must be in the document; if they're not,
+// the error is a DecodeErrors with a DecodeError for every missing field,
+// which matches ErrMissingField. The Path of the errors includes the index in
+// arrays of tables, e.g. servers[1].host.
+//
+// Fields can be validated with the "min", "max", "len", "oneof", and "pattern"
+// options; min and max are limits for numbers, or the length for strings,
+// arrays, and maps. Defaults from the struct tag are checked too. A value that
+// doesn't pass is an error that matches ErrValidation:
+//
+//	Port  int    `toml:"port,min=1,max=65535"`
+//	Level string `toml:"level,oneof=debug|info|warn"`
+//	Name  string `toml:"name,pattern=^[a-z]+$"`
 //
 // The mapping between TOML values and Go values is loose. That is, there
 // may exist TOML values that cannot be placed into your representation, and
 // there may be parts of your representation that do not correspond to
 // TOML values. This loose mapping can be made stricter by using the IsDefined
-// and/or Undecoded methods on the MetaData returned.
+// and/or Undecoded methods on the MetaData returned, or by using a Decoder
+// with DisallowUnknownFields.
 //
 // This decoder will not handle cyclic types. If a cyclic type is passed,
 // `Decode` will not terminate.
 func Decode(data string, v interface{}) (MetaData, error) {
+	return NewDecoder(strings.NewReader(data)).Decode(v)
+}
+
+// Version is a version of the TOML specification.
+type Version int
+
+// The versions of the TOML specification that can be used with
+// Decoder.SpecVersion.
+//
+// The TOML 1.1 draft adds newlines and trailing commas in inline tables, the
+// \e and \xHH escapes in basic strings, and times without seconds (07:32).
+const (
+	V0_4      Version = iota + 1 // TOML 0.4.0
+	V1_0                         // TOML 1.0.0; this is the default.
+	V1_1Draft                    // The unreleased TOML 1.1; this may change.
+)
+
+func (v Version) String() string {
+	switch v {
+	case V0_4:
+		return "TOML 0.4"
+	case V1_0:
+		return "TOML 1.0"
+	case V1_1Draft:
+		return "TOML 1.1 (draft)"
+	}
+	return fmt.Sprintf("TOML version %d", int(v))
+}
+
+// Decoder decodes TOML data from an input stream.
+//
+// The options are set with methods, and must be set before calling Decode.
+type Decoder struct {
+	r             io.Reader
+	version       Version
+	allErrors     bool
+	strict        bool
+	allow         [][]string
+	caseSensitive bool
+	useNumber     bool
+	loc           *time.Location
+	tagName       string
+	hooks         []DecodeHook
+	limits        Limits
+	lookupEnv     func(string) (string, bool)
+	refs          bool
+	includes      bool
+}
+
+// DecodeHook is called for every TOML value before it's decoded into a Go value
+// of type typ, with the full key of the value.
+//
+// It returns the value to decode instead, which can be data unchanged. Values
+// of the same type as typ are assigned as-is, so the hook can return a Go value
+// directly: for example a time.Duration parsed from a string.
+//
+// Integers and floats are passed as an int64 or float64, or as a Number if the
+// Decoder has UseNumber.
+type DecodeHook func(key Key, data interface{}, typ reflect.Type) (interface{}, error)
+
+// Limits on the size and complexity of documents, to guard against broken or
+// malicious input. Zero means no limit.
+//
+// Going over a limit is an error that matches ErrLimitExceeded.
+type Limits struct {
+	MaxBytes int64 // Size of the document in bytes.
+	MaxDepth int   // Nesting of tables and arrays; a.b = [[1]] is depth 4.
+	MaxKeys  int   // Number of keys and tables.
+}
+
+// NewDecoder returns a new Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, version: V1_0, tagName: "toml"}
+}
+
+// defaultDecoder has the options for a MetaData that doesn't come from a
+// Decoder.
+var defaultDecoder = NewDecoder(nil)
+
+// SpecVersion sets the version of the TOML specification that the document
+// must conform to; the default is V1_0.
+//
+// This affects which syntax is accepted: for example dotted keys, arrays with
+// values of different types, hexadecimal, octal, and binary integers, inf and
+// nan, and local dates and times are an error with V0_4, and inline tables can
+// only be extended by [table] headers with V0_4.
+func (dec *Decoder) SpecVersion(v Version) {
+	dec.version = v
+}
+
+// AllErrors makes Decode report all syntax errors in the document as
+// ParseErrors, rather than stopping at the first ParseError. After an error
+// parsing continues at the next line that looks like a key/value pair or
+// [table] header, so an error can cause more errors on the lines after it.
+//
+// Nothing is decoded if there are any errors.
+func (dec *Decoder) AllErrors() {
+	dec.allErrors = true
+}
+
+// DisallowUnknownFields makes Decode return an error if there are keys in the
+// document that don't correspond to a field in the Go value. The error is a
+// DecodeErrors with a DecodeError for every unknown key, which matches
+// ErrUnknownField; if there is a field with a similar name it's suggested in
+// the message.
+//
+// Keys decoded into an interface{}, Primitive, or a type that implements
+// Unmarshaler or encoding.TextUnmarshaler are never unknown.
+//
+// Keys that match one of the allow patterns are never unknown either; the
+// parts of a pattern are separated by dots, and "*" matches any key part. A
+// pattern also allows all keys below the keys it matches, so "plugins.*"
+// allows anything in the tables in [plugins], and the plugins table itself.
+func (dec *Decoder) DisallowUnknownFields(allow ...string) {
+	dec.strict = true
+	for _, a := range allow {
+		dec.allow = append(dec.allow, strings.Split(a, "."))
+	}
+}
+
+// CaseSensitive makes keys only match struct fields with exactly the same
+// name, rather than trying a case-insensitive match if there's no exact match.
+func (dec *Decoder) CaseSensitive() {
+	dec.caseSensitive = true
+}
+
+// UseNumber makes TOML integers and floats decode as a Number rather than an
+// int64 or float64 when they're decoded into an interface{}. This is also
+// what UnmarshalTOML methods and DecodeHooks get.
+func (dec *Decoder) UseNumber() {
+	dec.useNumber = true
+}
+
+// TimeLocation sets the location that local datetimes, dates, and times are
+// in when they're decoded into a time.Time; the default is time.Local.
+func (dec *Decoder) TimeLocation(loc *time.Location) {
+	dec.loc = loc
+}
+
+// TagName sets the struct tag that's used for the key names and options of
+// struct fields; the default is "toml".
+func (dec *Decoder) TagName(name string) {
+	dec.tagName = name
+}
+
+// Hook adds a DecodeHook. Hooks are run in the order they're added, each
+// getting the value returned by the previous one.
+func (dec *Decoder) Hook(h DecodeHook) {
+	dec.hooks = append(dec.hooks, h)
+}
+
+// ExpandEnv makes Decode replace ${NAME} in basic strings with the environment
+// variable NAME, or with default for ${NAME:-default} if it's unset or empty.
+// Use $${ for a literal ${. Literal strings ('...') are never expanded, nor are
+// keys.
+//
+// Variables are looked up with lookup, or os.LookupEnv if it's nil. A variable
+// that's not set and has no default is a ParseError that matches
+// ErrUndefinedVar.
+func (dec *Decoder) ExpandEnv(lookup func(name string) (string, bool)) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	dec.lookupEnv = lookup
+}
+
+// ExpandRefs makes Decode replace ${key} in basic strings with the value of key
+// in the same document, for example:
+//
+//	[paths]
+//	root = "/srv/app"
+//	logs = "${paths.root}/logs"
+//
+// The key is a full dotted key of bare keys, and must be a string; it can be
+// anywhere in the document, and can have references itself. The same syntax as
+// ExpandEnv is used for defaults and literal ${. If both are enabled keys in
+// the document take precedence over environment variables.
+//
+// References to a key that doesn't exist are a ParseError that matches
+// ErrUndefinedVar; references to a value that isn't a string or a cycle of
+// references match ErrReference.
+func (dec *Decoder) ExpandRefs() {
+	dec.refs = true
+}
+
+// Includes makes Decode read the files in the top-level "include" key, which
+// is a string or an array of strings with file names or filepath.Glob patterns:
+//
+//	include = ["base.toml", "secrets/*.toml"]
+//
+// Relative paths are relative to the directory of the file with the include
+// key, or the current directory if it's not read with DecodeFile. It's an error
+// if a file doesn't exist, but a pattern doesn't have to match anything.
+// Included files can include other files, but not themselves or a file that
+// includes them.
+//
+// Files are merged in the order they're in the include key (and in lexical
+// order for the files matched by a pattern); keys in later files replace keys
+// in earlier ones, and keys in the file with the include key replace keys in
+// all the files it includes. Tables are merged key by key, but any other value
+// is replaced entirely, including arrays and arrays of tables.
+//
+// Errors in an included file have the Filename of that file, and the include
+// key itself is never decoded. ExpandRefs references are expanded after all
+// files are merged, so they can refer to keys in other files.
+func (dec *Decoder) Includes() {
+	dec.includes = true
+}
+
+// Limits sets the Limits for documents; the default is no limits.
+func (dec *Decoder) Limits(l Limits) {
+	dec.limits = l
+}
+
+// Decode reads all the TOML data from the input and decodes it into the value
+// pointed to by v; see the Decode function for the details.
+func (dec *Decoder) Decode(v interface{}) (MetaData, error) {
+	return dec.decode(dec.r, "", v)
+}
+
+// decode decodes the data from r into v; fname is the file that r reads, if
+// it's known.
+func (dec *Decoder) decode(r io.Reader, fname string, v interface{}) (MetaData, error) {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr {
 		return MetaData{}, e("Decode of non-pointer %s", reflect.TypeOf(v))
@@ -105,35 +394,112 @@ func Decode(data string, v interface{}) (MetaData, error) {
 	if rv.IsNil() {
 		return MetaData{}, e("Decode of nil %s", reflect.TypeOf(v))
 	}
-	p, err := parse(data)
+	switch dec.version {
+	case V0_4, V1_0, V1_1Draft:
+	default:
+		return MetaData{}, e("unknown TOML version %d", int(dec.version))
+	}
+	if r == nil {
+		return MetaData{}, e("Decode with a nil io.Reader")
+	}
+
+	data, err := dec.read(r)
 	if err != nil {
 		return MetaData{}, err
 	}
+	var p *parser
+	if dec.includes {
+		p, err = dec.parseIncludes(data, fname)
+	} else {
+		p, err = parse(data, dec)
+	}
+	if err != nil {
+		return MetaData{}, setFilename(err, fname)
+	}
 	md := MetaData{
-		p.mapping, p.types, p.ordered,
-		make(map[string]bool, len(p.ordered)), nil,
+		mapping:   p.mapping,
+		types:     p.types,
+		positions: p.positions,
+		files:     p.files,
+		file:      fname,
+		keys:      p.ordered,
+		decoded:   make(map[string]bool, len(p.ordered)),
+		dec:       dec,
+	}
+	if err := md.unify(p.mapping, indirect(rv)); err != nil {
+		return md, err
+	}
+	if err := md.missingFields(); err != nil {
+		return md, err
+	}
+	if dec.strict {
+		return md, md.unknownFields()
+	}
+	return md, nil
+}
+
+// read reads all data from r, up to Limits.MaxBytes.
+func (dec *Decoder) read(r io.Reader) (string, error) {
+	if dec.limits.MaxBytes > 0 {
+		r = io.LimitReader(r, dec.limits.MaxBytes+1)
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if dec.limits.MaxBytes > 0 && int64(len(bs)) > dec.limits.MaxBytes {
+		return "", fmt.Errorf("%w: document is larger than %d bytes",
+			ErrLimitExceeded, dec.limits.MaxBytes)
+	}
+	return string(bs), nil
+}
+
+// setFilename sets the Filename on ParseErrors that don't have one yet, if
+// it's known.
+func setFilename(err error, fname string) error {
+	if fname == "" {
+		return err
+	}
+	switch pErr := err.(type) {
+	case ParseError:
+		if pErr.Filename == "" {
+			pErr.Filename = fname
+		}
+		return pErr
+	case ParseErrors:
+		for i := range pErr {
+			if pErr[i].Filename == "" {
+				pErr[i].Filename = fname
+			}
+		}
 	}
-	return md, md.unify(p.mapping, indirect(rv))
+	return err
 }
 
 // DecodeFile is just like Decode, except it will automatically read the
-// contents of the file at `fpath` and decode it for you.
+// contents of the file at `fpath` and decode it for you. The Filename of a
+// ParseError or DecodeError is set to `fpath`.
 func DecodeFile(fpath string, v interface{}) (MetaData, error) {
-	bs, err := ioutil.ReadFile(fpath)
+	return NewDecoder(nil).DecodeFile(fpath, v)
+}
+
+// DecodeFile is like Decode, but reads the file at fpath rather than the
+// io.Reader given to NewDecoder, which can be nil. The Filename of a
+// ParseError or DecodeError is set to fpath.
+func (dec *Decoder) DecodeFile(fpath string, v interface{}) (MetaData, error) {
+	fp, err := os.Open(fpath)
 	if err != nil {
 		return MetaData{}, err
 	}
-	return Decode(string(bs), v)
+	defer fp.Close()
+
+	return dec.decode(fp, fpath, v)
 }
 
 // DecodeReader is just like Decode, except it will consume all bytes
 // from the reader and decode it for you.
 func DecodeReader(r io.Reader, v interface{}) (MetaData, error) {
-	bs, err := ioutil.ReadAll(r)
-	if err != nil {
-		return MetaData{}, err
-	}
-	return Decode(string(bs), v)
+	return NewDecoder(r).Decode(v)
 }
 
 // unify performs a sort of type unification based on the structure of `rv`,
@@ -142,10 +508,55 @@ func DecodeReader(r io.Reader, v interface{}) (MetaData, error) {
 // Any type mismatch produces an error. Finding a type that we don't know
 // how to handle produces an unsupported type error.
 func (md *MetaData) unify(data interface{}, rv reflect.Value) error {
+	if hooks := md.decoder().hooks; len(hooks) > 0 {
+		in, err := md.hookValue(data, rv.Type())
+		if err != nil {
+			return err
+		}
+		out := in
+		for _, h := range hooks {
+			out, err = h(md.context, out, rv.Type())
+			if err != nil {
+				return md.wrap(err)
+			}
+		}
+		// Keep the original data if the hooks didn't change it, so that
+		// Numbers can still be decoded in to a Number, and are checked when
+		// they're decoded.
+		if !sameValue(in, out) {
+			if out != nil && reflect.TypeOf(out) == rv.Type() {
+				rv.Set(reflect.ValueOf(out))
+				md.markOpaque()
+				return nil
+			}
+			data = out
+		}
+	}
+
+	// Special case. Numbers are kept as they're written.
+	if rv.Type() == numberType {
+		if n, ok := data.(Number); ok {
+			rv.Set(reflect.ValueOf(n))
+			return nil
+		}
+		return md.badtype("number", data)
+	}
+
+	// Special case. Arbitrary-precision numbers are decoded from the text, as
+	// they may not fit in an int64 or float64.
+	if n, ok := data.(Number); ok {
+		switch v := bigValue(rv).(type) {
+		case *big.Int:
+			return md.unifyBigInt(n, v)
+		case *big.Float:
+			return md.unifyBigFloat(n, v)
+		}
+	}
 
 	// Special case. Look for a `Primitive` value.
 	// TODO: #76 would make this superfluous after implemented.
 	if rv.Type() == reflect.TypeOf((*Primitive)(nil)).Elem() {
+		md.markOpaque()
 		// Save the undecoded data and the key context into the primitive
 		// value.
 		context := make(Key, len(md.context))
@@ -157,24 +568,41 @@ func (md *MetaData) unify(data interface{}, rv reflect.Value) error {
 		return nil
 	}
 
+	// Special case. Datetimes are loaded directly in to a time.Time; local
+	// datetimes are interpreted in the local timezone. This may be a pointer
+	// if indirect() found the encoding.TextUnmarshaler.
+	if rv.Type() == timeType || (rv.Type() == reflect.PtrTo(timeType) && !rv.IsNil()) {
+		switch data.(type) {
+		case time.Time, LocalDatetime, LocalDate, LocalTime:
+			return md.unifyDatetime(data, reflect.Indirect(rv))
+		}
+	}
+
 	// Special case. Unmarshaler Interface support.
 	if rv.CanAddr() {
 		if v, ok := rv.Addr().Interface().(Unmarshaler); ok {
-			return v.UnmarshalTOML(data)
+			md.markOpaque()
+			data, err := md.goValue(data)
+			if err != nil {
+				return err
+			}
+			return md.wrap(v.UnmarshalTOML(data))
 		}
 	}
 
 	// Special case. Look for a value satisfying the TextUnmarshaler interface.
-	if v, ok := rv.Interface().(encoding.TextUnmarshaler); ok {
-		return md.unifyText(data, v)
+	// This is only used for primitive TOML values: a type that can also be
+	// decoded from a table or array (such as a struct) is decoded as usual
+	// from those.
+	if v, ok := textUnmarshaler(rv); ok {
+		if isPrimitive(data) || !canHoldTable(rv) {
+			md.markOpaque()
+			return md.unifyText(data, v)
+		}
+		if rv.Kind() == reflect.Ptr {
+			rv = rv.Elem() // From indirect(), so never nil.
+		}
 	}
-	// BUG(burntsushi)
-	// The behavior here is incorrect whenever a Go type satisfies the
-	// encoding.TextUnmarshaler interface but also corresponds to a TOML
-	// hash or array. In particular, the unmarshaler should only be applied
-	// to primitive TOML values. But at this point, it will be applied to
-	// all kinds of values and produce an incorrect error whenever those values
-	// are hashes or arrays (including arrays of tables).
 
 	k := rv.Kind()
 
@@ -206,7 +634,7 @@ func (md *MetaData) unify(data interface{}, rv reflect.Value) error {
 	case reflect.Interface:
 		// we only support empty interfaces.
 		if rv.NumMethod() > 0 {
-			return e("unsupported type %s", rv.Type())
+			return md.errorf(ErrUnsupportedType, "unsupported type %s", rv.Type())
 		}
 		return md.unifyAnything(data, rv)
 	case reflect.Float32:
@@ -214,7 +642,7 @@ func (md *MetaData) unify(data interface{}, rv reflect.Value) error {
 	case reflect.Float64:
 		return md.unifyFloat64(data, rv)
 	}
-	return e("unsupported type %s", rv.Kind())
+	return md.errorf(ErrUnsupportedType, "unsupported type %s", rv.Kind())
 }
 
 func (md *MetaData) unifyStruct(mapping interface{}, rv reflect.Value) error {
@@ -223,50 +651,184 @@ func (md *MetaData) unifyStruct(mapping interface{}, rv reflect.Value) error {
 		if mapping == nil {
 			return nil
 		}
-		return e("type mismatch for %s: expected table but found %T",
-			rv.Type().String(), mapping)
+		return md.errorf(ErrTypeMismatch, "type mismatch for %s: expected table but found %s",
+			rv.Type().String(), typeName(mapping))
 	}
 
-	for key, datum := range tmap {
-		var f *field
-		fields := cachedTypeFields(rv.Type())
-		for i := range fields {
-			ff := &fields[i]
-			if ff.name == key {
-				f = ff
-				break
+	if md.structs == nil {
+		md.structs = make(map[string]reflect.Type)
+	}
+	md.structs[md.context.String()] = rv.Type()
+
+	fields := cachedTypeFields(rv.Type(), md.decoder().tagName)
+	matched := make(map[*field]string, len(tmap))
+	for key := range tmap {
+		f := md.findField(fields, key)
+		if f == nil {
+			continue
+		}
+		if other, ok := matched[f]; ok {
+			// Report the key that comes last in the document, so the error
+			// doesn't depend on the map order.
+			if md.positions[md.context.add(key).String()].Start < md.positions[md.context.add(other).String()].Start {
+				key, other = other, key
 			}
-			if f == nil && strings.EqualFold(ff.name, key) {
-				f = ff
+			md.context = append(md.context, key)
+			return md.errorf(ErrDuplicateKey, "keys '%s' and '%s' both match field %s.%s",
+				other, key, rv.Type().String(), f.name)
+		}
+		matched[f] = key
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		key, ok := matched[f]
+		if !ok {
+			continue
+		}
+		subv := rv
+		for _, i := range f.index {
+			subv = indirect(subv.Field(i))
+		}
+		if isUnifiable(subv) {
+			md.decoded[md.context.add(key).String()] = true
+			md.context = append(md.context, key)
+			if err := md.unify(tmap[key], subv); err != nil {
+				return err
+			}
+			if err := md.validateField(f, subv); err != nil {
+				return err
 			}
+			md.context = md.context[0 : len(md.context)-1]
+		} else if f.name != "" {
+			// Bad user! No soup for you!
+			return md.errorf(ErrUnsupportedType, "cannot write unexported field %s.%s",
+				rv.Type().String(), f.name)
 		}
-		if f != nil {
-			subv := rv
-			for _, i := range f.index {
-				subv = indirect(subv.Field(i))
+	}
+
+	for i := range fields {
+		if _, ok := matched[&fields[i]]; !ok {
+			if err := md.setDefault(rv, &fields[i]); err != nil {
+				return err
 			}
-			if isUnifiable(subv) {
-				md.decoded[md.context.add(key).String()] = true
-				md.context = append(md.context, key)
-				if err := md.unify(datum, subv); err != nil {
-					return err
+		}
+	}
+
+	return md.validate(rv)
+}
+
+// validate calls the ValidateTOML method of the struct in rv, if it has one.
+func (md *MetaData) validate(rv reflect.Value) error {
+	if rv.CanAddr() {
+		if v, ok := rv.Addr().Interface().(Validator); ok {
+			return md.wrap(v.ValidateTOML(*md))
+		}
+	}
+	if v, ok := rv.Interface().(Validator); ok {
+		return md.wrap(v.ValidateTOML(*md))
+	}
+	return nil
+}
+
+// setDefault sets the default from the struct tag for a field of rv that isn't
+// in the document, and records it as missing if it's required. Structs in
+// fields without a default can have fields with defaults or required fields,
+// so these are set or recorded too, and then the struct is validated.
+func (md *MetaData) setDefault(rv reflect.Value, f *field) error {
+	md.context = append(md.context, f.name)
+	defer func() { md.context = md.context[0 : len(md.context)-1] }()
+
+	if f.opts.required {
+		// Use the position of the table it should be in.
+		err := md.errorf(ErrMissingField, "missing required field").(DecodeError)
+		err.Position = md.position(len(md.context) - 1)
+		err.Filename = md.filename(md.context.parent().String())
+		md.missing = append(md.missing, err)
+	}
+	if f.opts.def == nil {
+		subv, ok := fieldByIndex(rv, f.index)
+		if !ok || subv.Kind() != reflect.Struct || !subv.CanSet() {
+			return nil
+		}
+		fields := cachedTypeFields(subv.Type(), md.decoder().tagName)
+		for i := range fields {
+			if err := md.setDefault(subv, &fields[i]); err != nil {
+				return err
+			}
+		}
+		return md.validate(subv)
+	}
+
+	data, err := md.parseDefault(*f.opts.def)
+	if err != nil {
+		return err
+	}
+	subv := rv
+	for _, i := range f.index {
+		subv = indirect(subv.Field(i))
+	}
+	if err := md.unify(data, subv); err != nil {
+		return err
+	}
+	return md.validateField(f, subv)
+}
+
+// parseDefault parses a default from a struct tag as a TOML value.
+func (md *MetaData) parseDefault(def string) (interface{}, error) {
+	dec := NewDecoder(nil)
+	dec.version = md.decoder().version
+	p, err := parse("default = "+def, dec)
+	if err != nil {
+		msg := err.Error()
+		var pErr ParseError
+		if errors.As(err, &pErr) {
+			msg = pErr.Message
+		}
+		return nil, md.errorf(err, "invalid default %q: %s", def, msg)
+	}
+	return p.mapping["default"], nil
+}
+
+// fieldByIndex gets the field of rv with the index sequence, or false if it's
+// in an embedded struct that's a nil pointer.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if rv.Kind() == reflect.Ptr {
+				if rv.IsNil() {
+					return reflect.Value{}, false
 				}
-				md.context = md.context[0 : len(md.context)-1]
-			} else if f.name != "" {
-				// Bad user! No soup for you!
-				return e("cannot write unexported field %s.%s",
-					rv.Type().String(), f.name)
+				rv = rv.Elem()
 			}
 		}
+		rv = rv.Field(x)
 	}
-	return nil
+	return rv, true
+}
+
+// findField finds the field for the TOML key; this is an exact match on the
+// name if there is one, or else a case-insensitive match unless the Decoder is
+// CaseSensitive.
+func (md *MetaData) findField(fields []field, key string) *field {
+	var f *field
+	for i := range fields {
+		ff := &fields[i]
+		if ff.name == key {
+			return ff
+		}
+		if f == nil && !md.decoder().caseSensitive && strings.EqualFold(ff.name, key) {
+			f = ff
+		}
+	}
+	return f
 }
 
 func (md *MetaData) unifyMap(mapping interface{}, rv reflect.Value) error {
-	if k := rv.Type().Key().Kind(); k != reflect.String {
-		return fmt.Errorf(
-			"toml: cannot decode to a map with non-string key type (%s in %q)",
-			k, rv.Type())
+	kt := rv.Type().Key()
+	if !isMapKeyType(kt) {
+		return md.errorf(ErrUnsupportedType, "cannot decode to a map with unsupported key type (%s in %q)",
+			kt.Kind(), rv.Type())
 	}
 
 	tmap, ok := mapping.(map[string]interface{})
@@ -274,39 +836,96 @@ func (md *MetaData) unifyMap(mapping interface{}, rv reflect.Value) error {
 		if tmap == nil {
 			return nil
 		}
-		return badtype("map", mapping)
+		return md.badtype("map", mapping)
 	}
 	if rv.IsNil() {
 		rv.Set(reflect.MakeMap(rv.Type()))
 	}
-	for k, v := range tmap {
+	// Sorted so that errors are deterministic.
+	keys := make([]string, 0, len(tmap))
+	for k := range tmap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := tmap[k]
 		md.decoded[md.context.add(k).String()] = true
 		md.context = append(md.context, k)
 
-		rvkey := indirect(reflect.New(rv.Type().Key()))
+		rvkey := reflect.New(kt)
+		if err := md.unifyMapKey(k, rvkey); err != nil {
+			return err
+		}
 		rvval := reflect.Indirect(reflect.New(rv.Type().Elem()))
 		if err := md.unify(v, rvval); err != nil {
 			return err
 		}
 		md.context = md.context[0 : len(md.context)-1]
 
-		rvkey.SetString(k)
-		rv.SetMapIndex(rvkey, rvval)
+		rv.SetMapIndex(rvkey.Elem(), rvval)
+	}
+	return nil
+}
+
+// isMapKeyType reports if maps with keys of type t can be decoded: this is any
+// type that implements encoding.TextUnmarshaler, and strings and integers.
+func isMapKeyType(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// unifyMapKey sets the map key that ptr points to from the TOML key.
+func (md *MetaData) unifyMapKey(key string, ptr reflect.Value) error {
+	if v, ok := ptr.Interface().(encoding.TextUnmarshaler); ok {
+		return md.wrap(v.UnmarshalText([]byte(key)))
+	}
+
+	rv := ptr.Elem()
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, rv.Type().Bits())
+		if err != nil {
+			return md.mapKeyError(key, rv.Type(), err)
+		}
+		rv.SetInt(n)
+	default:
+		n, err := strconv.ParseUint(key, 10, rv.Type().Bits())
+		if err != nil {
+			return md.mapKeyError(key, rv.Type(), err)
+		}
+		rv.SetUint(n)
 	}
 	return nil
 }
 
+func (md *MetaData) mapKeyError(key string, t reflect.Type, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return md.errorf(ErrOutOfRange, "key %q is out of range for %s", key, t)
+	}
+	return md.errorf(ErrTypeMismatch, "key %q is not a valid %s", key, t)
+}
+
 func (md *MetaData) unifyArray(data interface{}, rv reflect.Value) error {
 	datav := reflect.ValueOf(data)
 	if datav.Kind() != reflect.Slice {
 		if !datav.IsValid() {
 			return nil
 		}
-		return badtype("slice", data)
+		return md.badtype("slice", data)
 	}
 	sliceLen := datav.Len()
 	if sliceLen != rv.Len() {
-		return e("expected array length %d; got TOML array of length %d",
+		return md.errorf(ErrTypeMismatch, "expected array length %d; got TOML array of length %d",
 			rv.Len(), sliceLen)
 	}
 	return md.unifySliceArray(datav, rv)
@@ -318,7 +937,7 @@ func (md *MetaData) unifySlice(data interface{}, rv reflect.Value) error {
 		if !datav.IsValid() {
 			return nil
 		}
-		return badtype("slice", data)
+		return md.badtype("slice", data)
 	}
 	n := datav.Len()
 	if rv.IsNil() || rv.Cap() < n {
@@ -333,19 +952,36 @@ func (md *MetaData) unifySliceArray(data, rv reflect.Value) error {
 	for i := 0; i < sliceLen; i++ {
 		v := data.Index(i).Interface()
 		sliceval := indirect(rv.Index(i))
+		md.indexes = append(md.indexes, arrayIndex{len(md.context), i})
 		if err := md.unify(v, sliceval); err != nil {
 			return err
 		}
+		md.indexes = md.indexes[:len(md.indexes)-1]
 	}
 	return nil
 }
 
 func (md *MetaData) unifyDatetime(data interface{}, rv reflect.Value) error {
-	if _, ok := data.(time.Time); ok {
-		rv.Set(reflect.ValueOf(data))
-		return nil
+	loc := md.decoder().loc
+	if loc == nil {
+		loc = time.Local
+	}
+
+	var t time.Time
+	switch d := data.(type) {
+	case time.Time:
+		t = d
+	case LocalDatetime:
+		t = d.In(loc)
+	case LocalDate:
+		t = d.In(loc)
+	case LocalTime:
+		t = d.In(loc)
+	default:
+		return md.badtype("time.Time", data)
 	}
-	return badtype("time.Time", data)
+	rv.Set(reflect.ValueOf(t))
+	return nil
 }
 
 func (md *MetaData) unifyString(data interface{}, rv reflect.Value) error {
@@ -353,10 +989,17 @@ func (md *MetaData) unifyString(data interface{}, rv reflect.Value) error {
 		rv.SetString(s)
 		return nil
 	}
-	return badtype("string", data)
+	return md.badtype("string", data)
 }
 
 func (md *MetaData) unifyFloat64(data interface{}, rv reflect.Value) error {
+	if n, ok := data.(Number); ok && n.isFloat() {
+		f, err := n.Float64()
+		if err != nil {
+			return md.wrap(err)
+		}
+		data = f
+	}
 	if num, ok := data.(float64); ok {
 		switch rv.Kind() {
 		case reflect.Float32:
@@ -368,54 +1011,94 @@ func (md *MetaData) unifyFloat64(data interface{}, rv reflect.Value) error {
 		}
 		return nil
 	}
-	return badtype("float", data)
+	return md.badtype("float", data)
 }
 
 func (md *MetaData) unifyInt(data interface{}, rv reflect.Value) error {
-	if num, ok := data.(int64); ok {
-		if rv.Kind() >= reflect.Int && rv.Kind() <= reflect.Int64 {
-			switch rv.Kind() {
-			case reflect.Int, reflect.Int64:
-				// No bounds checking necessary.
-			case reflect.Int8:
-				if num < math.MinInt8 || num > math.MaxInt8 {
-					return e("value %d is out of range for int8", num)
-				}
-			case reflect.Int16:
-				if num < math.MinInt16 || num > math.MaxInt16 {
-					return e("value %d is out of range for int16", num)
-				}
-			case reflect.Int32:
-				if num < math.MinInt32 || num > math.MaxInt32 {
-					return e("value %d is out of range for int32", num)
-				}
-			}
+	n, ok := data.(Number)
+	if !ok {
+		num, ok := data.(int64) // From a DecodeHook.
+		if !ok {
+			return md.badtype("integer", data)
+		}
+		n = Number(strconv.FormatInt(num, 10))
+	}
+	if n.isFloat() {
+		return md.badtype("integer", data)
+	}
+
+	var err error
+	if rv.Kind() >= reflect.Int && rv.Kind() <= reflect.Int64 {
+		var num int64
+		num, err = strconv.ParseInt(string(n), 0, rv.Type().Bits())
+		if err == nil {
 			rv.SetInt(num)
-		} else if rv.Kind() >= reflect.Uint && rv.Kind() <= reflect.Uint64 {
-			unum := uint64(num)
-			switch rv.Kind() {
-			case reflect.Uint, reflect.Uint64:
-				// No bounds checking necessary.
-			case reflect.Uint8:
-				if num < 0 || unum > math.MaxUint8 {
-					return e("value %d is out of range for uint8", num)
-				}
-			case reflect.Uint16:
-				if num < 0 || unum > math.MaxUint16 {
-					return e("value %d is out of range for uint16", num)
-				}
-			case reflect.Uint32:
-				if num < 0 || unum > math.MaxUint32 {
-					return e("value %d is out of range for uint32", num)
-				}
+		}
+	} else {
+		// Negative numbers are out of range, except for -0.
+		var unum uint64
+		if strings.HasPrefix(string(n), "-") {
+			if _, err = strconv.ParseInt(string(n), 0, 64); err == nil && strings.Trim(string(n), "-0_") != "" {
+				err = strconv.ErrRange
 			}
-			rv.SetUint(unum)
 		} else {
-			panic("unreachable")
+			unum, err = strconv.ParseUint(strings.TrimPrefix(string(n), "+"), 0, rv.Type().Bits())
 		}
-		return nil
+		if err == nil {
+			rv.SetUint(unum)
+		}
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return md.errorf(ErrOutOfRange, "value %s is out of range for %s", n, rv.Kind())
+	}
+	if err != nil {
+		return md.badtype("integer", data)
+	}
+	return nil
+}
+
+// bigValue returns a *big.Int or *big.Float if rv is one (or a pointer to one),
+// or nil otherwise.
+func bigValue(rv reflect.Value) interface{} {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if (rv.Type() == bigIntType || rv.Type() == bigFloatType) && rv.CanAddr() {
+		return rv.Addr().Interface()
 	}
-	return badtype("integer", data)
+	return nil
+}
+
+func (md *MetaData) unifyBigInt(n Number, z *big.Int) error {
+	if n.isFloat() {
+		return md.badtype("big.Int", n)
+	}
+	if _, ok := z.SetString(strings.Replace(string(n), "_", "", -1), 0); !ok {
+		return md.badtype("big.Int", n)
+	}
+	return nil
+}
+
+func (md *MetaData) unifyBigFloat(n Number, z *big.Float) error {
+	s := strings.Replace(string(n), "_", "", -1)
+	if strings.HasSuffix(s, "nan") {
+		return md.errorf(ErrOutOfRange, "value %s is out of range for big.Float", n)
+	}
+	if z.Prec() == 0 {
+		// Enough to keep all the digits; the default is only 64 bits.
+		prec := uint(len(s)) * 4
+		if prec < 64 {
+			prec = 64
+		}
+		z.SetPrec(prec)
+	}
+	if _, _, err := z.Parse(s, 0); err != nil {
+		return md.badtype("big.Float", n)
+	}
+	return nil
 }
 
 func (md *MetaData) unifyBool(data interface{}, rv reflect.Value) error {
@@ -423,21 +1106,163 @@ func (md *MetaData) unifyBool(data interface{}, rv reflect.Value) error {
 		rv.SetBool(b)
 		return nil
 	}
-	return badtype("boolean", data)
+	return md.badtype("boolean", data)
 }
 
 func (md *MetaData) unifyAnything(data interface{}, rv reflect.Value) error {
+	md.markOpaque()
+	data, err := md.goValue(data)
+	if err != nil {
+		return err
+	}
 	rv.Set(reflect.ValueOf(data))
 	return nil
 }
 
+// goValue returns data with the Numbers in it converted to an int64 or float64,
+// unless the Decoder has UseNumber.
+func (md *MetaData) goValue(data interface{}) (interface{}, error) {
+	if md.decoder().useNumber {
+		return data, nil
+	}
+	return md.convertNumbers(data, true)
+}
+
+// hookValue returns the value of data for the DecodeHooks, which is data with
+// the Numbers converted as with goValue.
+//
+// A Number that's out of range is kept as-is in tables and arrays, as it's
+// checked when it's decoded; this also means that the hooks get the Number
+// for types that can hold it, such as big.Int or uint64.
+func (md *MetaData) hookValue(data interface{}, typ reflect.Type) (interface{}, error) {
+	if md.decoder().useNumber {
+		return data, nil
+	}
+	if n, ok := data.(Number); ok {
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ == numberType || typ == bigIntType || typ == bigFloatType {
+			return n, nil
+		}
+		switch typ.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return md.convertNumbers(n, false)
+		}
+		v, err := n.value()
+		return v, md.wrap(err)
+	}
+	return md.convertNumbers(data, false)
+}
+
+// convertNumbers converts the Numbers in data to an int64 or float64; it's an
+// error if one is out of range, unless strict is false.
+//
+// Tables and arrays that are converted without strict are cached, so that
+// they're not copied again for the hooks of every value in them.
+func (md *MetaData) convertNumbers(data interface{}, strict bool) (interface{}, error) {
+	var ptr uintptr
+	switch d := data.(type) {
+	case Number:
+		v, err := d.value()
+		if err != nil && !strict {
+			return d, nil
+		}
+		return v, md.wrap(err)
+	case map[string]interface{}, []map[string]interface{}, []interface{}:
+		if rv := reflect.ValueOf(d); !strict && rv.Len() > 0 {
+			ptr = rv.Pointer()
+			if v, ok := md.converted[ptr]; ok {
+				return v, nil
+			}
+		}
+	default:
+		return data, nil
+	}
+
+	var conv interface{}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		// Sort the keys, so that the same error is always reported first.
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		m := make(map[string]interface{}, len(d))
+		for _, k := range keys {
+			md.context = append(md.context, k)
+			v, err := md.convertNumbers(d[k], strict)
+			if err != nil {
+				return nil, err
+			}
+			md.context = md.context[0 : len(md.context)-1]
+			m[k] = v
+		}
+		conv = m
+	case []map[string]interface{}:
+		s := make([]map[string]interface{}, len(d))
+		for i, v := range d {
+			v, err := md.convertNumbers(v, strict)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v.(map[string]interface{})
+		}
+		conv = s
+	case []interface{}:
+		s := make([]interface{}, len(d))
+		for i, v := range d {
+			v, err := md.convertNumbers(v, strict)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		conv = s
+	}
+
+	if ptr != 0 {
+		if md.converted == nil {
+			md.converted = make(map[uintptr]interface{})
+		}
+		md.converted[ptr] = conv
+	}
+	return conv, nil
+}
+
+// sameValue reports if a and b are the same value; maps and slices are the
+// same if they're the same object.
+func sameValue(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	if va.Type() != vb.Type() {
+		return false
+	}
+	switch va.Kind() {
+	case reflect.Map, reflect.Slice:
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	}
+	return va.Type().Comparable() && a == b
+}
+
 func (md *MetaData) unifyText(data interface{}, v encoding.TextUnmarshaler) error {
+	if n, ok := data.(Number); ok {
+		v, err := n.value()
+		if err != nil {
+			return md.wrap(err)
+		}
+		data = v
+	}
 	var s string
 	switch sdata := data.(type) {
 	case TextMarshaler:
 		text, err := sdata.MarshalText()
 		if err != nil {
-			return err
+			return md.wrap(err)
 		}
 		s = string(text)
 	case fmt.Stringer:
@@ -451,10 +1276,10 @@ func (md *MetaData) unifyText(data interface{}, v encoding.TextUnmarshaler) erro
 	case float64:
 		s = fmt.Sprintf("%f", sdata)
 	default:
-		return badtype("primitive (string-like)", data)
+		return md.badtype("primitive (string-like)", data)
 	}
 	if err := v.UnmarshalText([]byte(s)); err != nil {
-		return err
+		return md.wrap(err)
 	}
 	return nil
 }
@@ -486,6 +1311,45 @@ func indirect(v reflect.Value) reflect.Value {
 	return indirect(reflect.Indirect(v))
 }
 
+// textUnmarshaler returns rv as an encoding.TextUnmarshaler, also if only a
+// pointer to rv implements it.
+func textUnmarshaler(rv reflect.Value) (encoding.TextUnmarshaler, bool) {
+	if v, ok := rv.Interface().(encoding.TextUnmarshaler); ok {
+		return v, true
+	}
+	if rv.CanAddr() {
+		if v, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// isPrimitive reports if data is a TOML value other than a table or array.
+func isPrimitive(data interface{}) bool {
+	switch data.(type) {
+	case map[string]interface{}, []map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// canHoldTable reports if rv (or what it points to) can be decoded from a TOML
+// table or array.
+func canHoldTable(rv reflect.Value) bool {
+	t := rv.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != timeType
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
 func isUnifiable(rv reflect.Value) bool {
 	if rv.CanSet() {
 		return true
@@ -496,6 +1360,226 @@ func isUnifiable(rv reflect.Value) bool {
 	return false
 }
 
-func badtype(expected string, data interface{}) error {
-	return e("cannot load TOML value of type %T into a Go %s", data, expected)
+// markOpaque records that the value that's being decoded is decoded as a
+// whole, so that the keys below it aren't unknown fields.
+func (md *MetaData) markOpaque() {
+	if md.opaque == nil {
+		md.opaque = make(map[string]bool)
+	}
+	md.opaque[md.context.String()] = true
+}
+
+// missingFields returns an error for the required fields that weren't in the
+// document, if any.
+func (md *MetaData) missingFields() error {
+	if len(md.missing) == 0 {
+		return nil
+	}
+	return md.missing
+}
+
+// unknownFields returns an error for the keys that weren't decoded, except
+// those under an opaque value or allowed by the Decoder. Only the top-most
+// unknown key is reported, and not the keys in it.
+func (md *MetaData) unknownFields() error {
+	var (
+		errs     DecodeErrors
+		reported = make(map[string]bool)
+	)
+	for _, key := range md.Undecoded() {
+		k := key.String()
+		if reported[k] || reported[key.parent().String()] {
+			reported[k] = true
+			continue
+		}
+		if md.isOpaque(key) || md.isAllowed(key) {
+			continue
+		}
+		reported[k] = true
+
+		msg := "unknown field"
+		if s := md.suggest(key); s != "" {
+			msg += fmt.Sprintf("; did you mean '%s'?", s)
+		}
+		errs = append(errs, DecodeError{
+			Message:  msg,
+			Key:      key,
+			Position: md.positions[k],
+			Filename: md.filename(k),
+			err:      ErrUnknownField,
+		})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isAllowed reports if key matches one of the allow patterns of the Decoder,
+// or if it's a table that has keys that may match.
+func (md *MetaData) isAllowed(key Key) bool {
+	for _, pat := range md.decoder().allow {
+		n := len(pat)
+		if len(key) < n {
+			if !typeIsHash(md.types[key.String()]) {
+				continue
+			}
+			n = len(key)
+		}
+		match := true
+		for i := 0; i < n; i++ {
+			if pat[i] != "*" && pat[i] != key[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest finds the field name of the struct that key's table was decoded into
+// that's closest to the last part of key, or "" if there isn't one that's
+// close enough.
+func (md *MetaData) suggest(key Key) string {
+	typ, ok := md.structs[key.parent().String()]
+	if !ok {
+		return ""
+	}
+	var (
+		name = strings.ToLower(key[len(key)-1])
+		best string
+		dist = len(name)/3 + 1 // Allow about one typo in three characters.
+	)
+	for _, f := range cachedTypeFields(typ, md.decoder().tagName) {
+		if d := levenshtein(name, strings.ToLower(f.name)); d <= dist && (best == "" || d < dist) {
+			best, dist = f.name, d
+		}
+	}
+	return best
+}
+
+// isOpaque reports if key or one of its parents is opaque.
+func (md *MetaData) isOpaque(key Key) bool {
+	for i := 0; i < len(key); i++ {
+		if md.opaque[key[:i].String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// errorf returns a DecodeError for the value that's being decoded, which wraps
+// err.
+func (md *MetaData) errorf(err error, format string, args ...interface{}) error {
+	return DecodeError{
+		Message:  fmt.Sprintf(format, args...),
+		Key:      append(Key{}, md.context...),
+		Path:     md.path(),
+		Position: md.position(len(md.context)),
+		Filename: md.filename(md.context.String()),
+		err:      err,
+	}
+}
+
+// position gets the position of the first n parts of the key that's being
+// decoded; this is the position in the element of arrays of tables if it's
+// known.
+func (md *MetaData) position(n int) Position {
+	if pos, ok := md.positions[md.pathOf(n)]; ok {
+		return pos
+	}
+	return md.positions[md.context[:n].String()]
+}
+
+// filename gets the name of the file that a key is in, if it's known.
+func (md *MetaData) filename(key string) string {
+	if f, ok := md.files[key]; ok {
+		return f
+	}
+	return md.file
+}
+
+// path gets the key of the value that's being decoded, with the index in
+// arrays.
+func (md *MetaData) path() string {
+	return md.pathOf(len(md.context))
+}
+
+// pathOf gets the path of the first n parts of the key that's being decoded.
+func (md *MetaData) pathOf(n int) string {
+	b := new(strings.Builder)
+	idx := md.indexes
+	for i, k := range md.context[:n] {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(k)
+		for len(idx) > 0 && idx[0].depth == i+1 {
+			fmt.Fprintf(b, "[%d]", idx[0].index)
+			idx = idx[1:]
+		}
+	}
+	return b.String()
+}
+
+// wrap returns a DecodeError for an error from an UnmarshalTOML or
+// UnmarshalText method, or nil if err is nil.
+func (md *MetaData) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return md.errorf(err, "%s", err)
+}
+
+func (md *MetaData) badtype(expected string, data interface{}) error {
+	return md.errorf(ErrTypeMismatch, "cannot load TOML value of type %s into a Go %s", typeName(data), expected)
+}
+
+// typeName gets the name of the Go type of data for errors; Numbers are
+// reported as int64 or float64.
+func typeName(data interface{}) string {
+	if n, ok := data.(Number); ok {
+		if n.isFloat() {
+			return "float64"
+		}
+		return "int64"
+	}
+	return fmt.Sprintf("%T", data)
+}
+
+// levenshtein returns the number of single-character edits needed to change a
+// into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur := row[j]
+			row[j] = min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev = cur
+		}
+	}
+	return row[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
 }
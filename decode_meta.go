@@ -1,16 +1,50 @@
 package toml
 
-import "strings"
+import (
+	"reflect"
+	"strings"
+)
 
 // MetaData allows access to meta information about TOML data that may not
 // be inferrable via reflection. In particular, whether a key has been defined
 // and the TOML type of a key.
 type MetaData struct {
-	mapping map[string]interface{}
-	types   map[string]tomlType
-	keys    []Key
-	decoded map[string]bool
-	context Key // Used only during decoding.
+	mapping   map[string]interface{}
+	types     map[string]tomlType
+	positions map[string]Position
+	files     map[string]string // File every key is from, if files were included.
+	file      string            // File that was decoded, if it's known.
+	keys      []Key
+	decoded   map[string]bool
+	context   Key // Used only during decoding.
+
+	// Keys of values that were decoded as a whole (e.g. into an interface{}),
+	// so that the keys below them aren't unknown fields.
+	opaque  map[string]bool
+	structs map[string]reflect.Type // Struct types that tables were decoded into.
+
+	indexes []arrayIndex // Indexes in arrays of the value being decoded.
+	missing DecodeErrors // Required fields that aren't in the document.
+
+	// Tables and arrays with the Numbers converted for the DecodeHooks, by
+	// the pointer of the original.
+	converted map[uintptr]interface{}
+
+	dec *Decoder // Options; nil if the MetaData doesn't come from a Decoder.
+}
+
+// arrayIndex is the index of an element in the array with the key
+// context[:depth].
+type arrayIndex struct {
+	depth, index int
+}
+
+// decoder gets the Decoder with the options for decoding.
+func (md *MetaData) decoder() *Decoder {
+	if md.dec == nil {
+		return defaultDecoder
+	}
+	return md.dec
 }
 
 // IsDefined returns true if the key given exists in the TOML data. The key
@@ -84,6 +118,15 @@ func (k Key) maybeQuoted(i int) string {
 	return k[i]
 }
 
+// parent returns the key of the table that k is in; this is empty for
+// top-level keys.
+func (k Key) parent() Key {
+	if len(k) == 0 {
+		return k
+	}
+	return k[:len(k)-1]
+}
+
 func (k Key) add(piece string) Key {
 	newKey := make(Key, len(k)+1)
 	copy(newKey, k)
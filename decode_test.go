@@ -1,10 +1,16 @@
 package toml
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -425,7 +431,8 @@ func TestDecodeDatetime(t *testing.T) {
 		// instant in time without additional information. Conversion to an
 		// instant, if required, is implementation-specific."
 		//
-		// Go doesn't supporting a time without a timezone, so use time.Local.
+		// These are LocalDatetime, LocalDate, and LocalTime values, which are
+		// converted to a time.Time in time.Local.
 		{"1979-05-27T07:32:00", time.Date(1979, 05, 27, 07, 32, 0, 0, time.Local)},
 		{"1979-05-27T07:32:00.999999", time.Date(1979, 05, 27, 07, 32, 0, 999999000, time.Local)},
 		{"1979-05-27T07:32:00.25", time.Date(1979, 05, 27, 07, 32, 0, 250000000, time.Local)},
@@ -452,6 +459,60 @@ func TestDecodeDatetime(t *testing.T) {
 	}
 }
 
+func TestDecodeLocalDatetime(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		want     interface{}
+		wantType string
+	}{
+		{"1979-05-27T07:32:00Z", time.Date(1979, 05, 27, 07, 32, 0, 0, time.UTC), "Datetime"},
+		{"1979-05-27T07:32:00", LocalDatetime{LocalDate{1979, 05, 27}, LocalTime{07, 32, 0, 0}}, "LocalDatetime"},
+		{"1979-05-27 07:32:00.25", LocalDatetime{LocalDate{1979, 05, 27}, LocalTime{07, 32, 0, 250000000}}, "LocalDatetime"},
+		{"1979-05-27", LocalDate{1979, 05, 27}, "LocalDate"},
+		{"07:32:00", LocalTime{07, 32, 0, 0}, "LocalTime"},
+		{"07:32:00.999999", LocalTime{07, 32, 0, 999999000}, "LocalTime"},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			input := "d = " + tt.in
+
+			var x struct{ D interface{} }
+			md, err := Decode(input, &x)
+			if err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			if !reflect.DeepEqual(x.D, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", x.D, tt.want)
+			}
+			if typ := md.Type("d"); typ != tt.wantType {
+				t.Errorf("type\nhave: %s\nwant: %s", typ, tt.wantType)
+			}
+
+			// Decode in to a map[string]T, where T is the type of want.
+			typed := reflect.New(reflect.MapOf(reflect.TypeOf(""), reflect.TypeOf(tt.want)))
+			if _, err := Decode(input, typed.Interface()); err != nil {
+				t.Fatalf("got error: %s", err)
+			}
+			have := typed.Elem().MapIndex(reflect.ValueOf("d")).Interface()
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", have, tt.want)
+			}
+		})
+	}
+
+	var m map[string]time.Time
+	if _, err := Decode("d = 1979-05-27", &m); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(1979, 05, 27, 0, 0, 0, 0, time.Local); !m["d"].Equal(want) {
+		t.Errorf("\nhave: %s\nwant: %s", m["d"], want)
+	}
+
+	var ld struct{ D LocalDate }
+	if _, err := Decode("d = 07:32:00", &ld); err == nil {
+		t.Error("no error decoding a local time in to a LocalDate")
+	}
+}
+
 func TestDecodeBadDatetime(t *testing.T) {
 	var x struct{ T time.Time }
 	for _, s := range []string{
@@ -480,6 +541,48 @@ func TestDecodeSimpleArray(t *testing.T) {
 	}
 }
 
+func TestDecodeMixedArray(t *testing.T) {
+	var x struct {
+		A []interface{}
+		B []interface{}
+		C [][]interface{}
+	}
+	md, err := Decode(`
+a = [1, "two", {x = 3}]
+b = [1, 2]
+c = [[1, 2.5], ["a"]]
+`, &x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{int64(1), "two", map[string]interface{}{"x": int64(3)}}
+	if !reflect.DeepEqual(x.A, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", x.A, want)
+	}
+	for _, tt := range []struct {
+		key  string
+		want string
+	}{
+		{"a", "Array(Integer, String, Hash)"},
+		{"b", "Array"},
+		{"c", "Array(Array(Integer, Float), Array)"},
+	} {
+		if typ := md.Type(tt.key); typ != tt.want {
+			t.Errorf("type of %q\nhave: %s\nwant: %s", tt.key, typ, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(x); err != nil {
+		t.Fatal(err)
+	}
+	wantTOML := "A = [1, \"two\", {x = 3}]\nB = [1, 2]\nC = [[1, 2.5], [\"a\"]]\n"
+	if buf.String() != wantTOML {
+		t.Errorf("\nhave: %q\nwant: %q", buf.String(), wantTOML)
+	}
+}
+
 func TestDecodeArrayWrongSize(t *testing.T) {
 	var s1 sphere
 	if _, err := Decode(`center = [0.1, 2.3]`, &s1); err == nil {
@@ -684,8 +787,8 @@ func TestDecodeTypes(t *testing.T) {
 
 		{3, "non-pointer int"},
 		{(*int)(nil), "nil"},
-		{new(map[int]string), "cannot decode to a map with non-string key type"},
-		{new(map[interface{}]string), "cannot decode to a map with non-string key type"},
+		{new(map[int]string), `key "x" is not a valid int`},
+		{new(map[interface{}]string), "cannot decode to a map with unsupported key type"},
 	} {
 		t.Run(fmt.Sprintf("%T", tt.v), func(t *testing.T) {
 			_, err := Decode(`x = 3`, tt.v)
@@ -883,366 +986,1980 @@ func TestDecodeMalformedInlineTable(t *testing.T) {
 	}
 }
 
-type menu struct {
-	Dishes map[string]dish
-}
+func TestDecodeDottedKeys(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		want     map[string]interface{}
+		wantKeys []string
+	}{
+		{
+			"a.b.c = 1\na.b.d = 2\na.e = 3",
+			map[string]interface{}{"a": map[string]interface{}{
+				"b": map[string]interface{}{"c": int64(1), "d": int64(2)},
+				"e": int64(3),
+			}},
+			[]string{"a", "a.b", "a.b.c", "a.b.d", "a.e"},
+		},
+		{
+			`a . "b.c" . 'd' = 1`,
+			map[string]interface{}{"a": map[string]interface{}{
+				"b.c": map[string]interface{}{"d": int64(1)},
+			}},
+			[]string{"a", "a.b.c", "a.b.c.d"},
+		},
+		{
+			"[tbl]\na.b = 1\n[tbl.a.c]\nx = 2",
+			map[string]interface{}{"tbl": map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": int64(1),
+					"c": map[string]interface{}{"x": int64(2)},
+				},
+			}},
+			[]string{"tbl", "tbl.a", "tbl.a.b", "tbl.a.c", "tbl.a.c.x"},
+		},
+		{
+			"[a.b.c]\n[a]\nb.d = 1",
+			map[string]interface{}{"a": map[string]interface{}{
+				"b": map[string]interface{}{
+					"c": map[string]interface{}{},
+					"d": int64(1),
+				},
+			}},
+			[]string{"a.b.c", "a", "a.b", "a.b.d"},
+		},
+		{
+			"x = {a.b = 1, a.c = 2}",
+			map[string]interface{}{"x": map[string]interface{}{
+				"a": map[string]interface{}{"b": int64(1), "c": int64(2)},
+			}},
+			[]string{"x.a", "x.a.b", "x.a.c", "x"},
+		},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			var got map[string]interface{}
+			md, err := Decode(tt.in, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", got, tt.want)
+			}
 
-func (m *menu) UnmarshalTOML(p interface{}) error {
-	m.Dishes = make(map[string]dish)
-	data, _ := p.(map[string]interface{})
-	dishes := data["dishes"].(map[string]interface{})
-	for n, v := range dishes {
-		if d, ok := v.(map[string]interface{}); ok {
-			nd := dish{}
-			nd.UnmarshalTOML(d)
-			m.Dishes[n] = nd
-		} else {
-			return fmt.Errorf("not a dish")
-		}
+			var keys []string
+			for _, k := range md.Keys() {
+				keys = append(keys, k.String())
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys\nhave: %q\nwant: %q", keys, tt.wantKeys)
+			}
+			if typ := md.Type(md.Keys()[0]...); typ != "Hash" {
+				t.Errorf("type of %q is %q; want Hash", md.Keys()[0], typ)
+			}
+		})
 	}
-	return nil
 }
 
-type dish struct {
-	Name        string
-	Price       float32
-	Ingredients []ingredient
+func TestDecodeDottedKeysRedefine(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{"a.b.c = 1\n[a]", "Key 'a' has already been defined"},
+		{"a.b.c = 1\n[a.b]", "Key 'a.b' has already been defined"},
+		{"a.b = 1\na.b.c = 2", "Key 'a.b' has already been defined"},
+		{"a.b.c = 1\na.b = 2", "Key 'a.b' has already been defined"},
+		{"a = {x = 1}\na.y = 2", "Key 'a' has already been defined"},
+		{"[a.b.c]\n[a]\nb.d = 1\n[a.b]", "Key 'a.b' has already been defined"},
+		{"[a.b.c]\nz = 1\n[a]\nb.c.t = 1", "Key 'a.b.c' has already been defined"},
+		{"x = {a.b = 1, a = 2}", "Key 'x.a' has already been defined"},
+		{"x = {a = {b = 1}, a.c = 2}", "Key 'x.a' has already been defined"},
+		{"x = {a = 1, a = 2}", "Key 'x.a' has already been defined"},
+		{"a. = 1", "keys cannot be empty"},
+		{"a..b = 1", "keys cannot be empty"},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			var x interface{}
+			_, err := Decode(tt.in, &x)
+			if !errorContains(err, tt.want) {
+				t.Errorf("wrong error\nhave: %v\nwant: %q", err, tt.want)
+			}
+		})
+	}
 }
 
-func (d *dish) UnmarshalTOML(p interface{}) error {
-	data, _ := p.(map[string]interface{})
-	d.Name, _ = data["name"].(string)
-	d.Price, _ = data["price"].(float32)
-	ingredients, _ := data["ingredients"].([]map[string]interface{})
-	for _, e := range ingredients {
-		n, _ := interface{}(e).(map[string]interface{})
-		name, _ := n["name"].(string)
-		i := ingredient{name}
-		d.Ingredients = append(d.Ingredients, i)
+func TestDecodeSpecVersion(t *testing.T) {
+	for _, tt := range []struct {
+		in                        string
+		want0_4, want1_0, want1_1 string
+	}{
+		{"a.b = 1", "Dotted keys are not allowed in TOML 0.4", "", ""},
+		{"a = {b.c = 1}", "Dotted keys are not allowed in TOML 0.4", "", ""},
+		{"a = [1, 'x']", "arrays must be homogeneous in TOML 0.4", "", ""},
+		{"a = [[1], ['x']]", "", "", ""},
+		{"a = {x = 1}\n[a.b]", "", "inline table and can't be extended", "inline table and can't be extended"},
+		{"a = {x = 1}\n[a]", "already been defined", "already been defined", "already been defined"},
+		{"# \x01", "", "control characters are not allowed inside comments", ""},
+		{"# \x7f", "", "control characters are not allowed inside comments", ""},
+		{"# \r", "", "control characters are not allowed inside comments", ""},
+		{"# \r\na = 1", "", "", ""},
+		{"# \t", "", "", ""},
+		{"a = {x = 1,\n y = 2}", "newlines not allowed", "newlines not allowed", ""},
+		{"a = {\n# c\n x = 1 # c\n}", "newlines not allowed", "newlines not allowed", ""},
+		{"a = {x = 1,}", "trailing comma", "trailing comma", ""},
+		{"a = {x = 1, }", "trailing comma", "trailing comma", ""},
+		{"a = {,}", "unexpected comma", "unexpected comma", "unexpected comma"},
+		{"a = {x = 1,,}", "unexpected comma", "unexpected comma", "unexpected comma"},
+		{"a = {x =\n 1}", "expected value", "expected value", "expected value"},
+		{`a = "\e"`, "invalid escape", "invalid escape", ""},
+		{`a = "\x41"`, "invalid escape", "invalid escape", ""},
+		{`a = "\x4"`, "invalid escape", "invalid escape", "expected two hexadecimal digits"},
+		{`a = "\xZZ"`, "invalid escape", "invalid escape", "expected two hexadecimal digits"},
+		{"a = 07:32", "Invalid TOML Datetime", "Invalid TOML Datetime", ""},
+		{"a = 1979-05-27T07:32", "Invalid TOML Datetime", "Invalid TOML Datetime", ""},
+		{"a = 1979-05-27 07:32Z", "Invalid TOML Datetime", "Invalid TOML Datetime", ""},
+		{"a = 07:32.5", "Invalid TOML Datetime", "Invalid TOML Datetime", "Invalid TOML Datetime"},
+		{"a = 0xff", "hexadecimal, octal, and binary integers are not allowed in TOML 0.4", "", ""},
+		{"a = 0o17", "hexadecimal, octal, and binary integers are not allowed in TOML 0.4", "", ""},
+		{"a = 0b11", "hexadecimal, octal, and binary integers are not allowed in TOML 0.4", "", ""},
+		{"a = 0", "", "", ""},
+		{"a = -inf", "inf and nan are not allowed in TOML 0.4", "", ""},
+		{"a = nan", "inf and nan are not allowed in TOML 0.4", "", ""},
+		{"a = 1e10", "", "", ""},
+		{"a = 1979-05-27", "local dates and times are not allowed in TOML 0.4", "", ""},
+		{"a = 07:32:00", "local dates and times are not allowed in TOML 0.4", "", ""},
+		{"a = 1979-05-27T07:32:00", "local dates and times are not allowed in TOML 0.4", "", ""},
+		{"a = 1979-05-27 07:32:00Z", "a space between the date and time is not allowed in TOML 0.4", "", ""},
+		{"a = 1979-05-27T07:32:00Z", "", "", ""},
+	} {
+		for _, v := range []struct {
+			version Version
+			want    string
+		}{{V0_4, tt.want0_4}, {V1_0, tt.want1_0}, {V1_1Draft, tt.want1_1}} {
+			t.Run(fmt.Sprintf("%s/%q", v.version, tt.in), func(t *testing.T) {
+				dec := NewDecoder(strings.NewReader(tt.in))
+				dec.SpecVersion(v.version)
+
+				var x interface{}
+				_, err := dec.Decode(&x)
+				if !errorContains(err, v.want) {
+					t.Errorf("wrong error\nhave: %v\nwant: %q", err, v.want)
+				}
+			})
+		}
+	}
+
+	dec := NewDecoder(strings.NewReader(""))
+	dec.SpecVersion(42)
+	var x interface{}
+	if _, err := dec.Decode(&x); !errorContains(err, "unknown TOML version 42") {
+		t.Errorf("wrong error: %v", err)
 	}
-	return nil
 }
 
-type ingredient struct {
-	Name string
+func TestDecodeTOML11(t *testing.T) {
+	in := `
+tbl = {
+	a = "\e[1m\x41\xe9", # Comment
+	b = 07:32,
 }
+ldt = 1979-05-27T07:32
+dt  = 1979-05-27 07:32-07:00
+`
+	dec := NewDecoder(strings.NewReader(in))
+	dec.SpecVersion(V1_1Draft)
 
-func TestDecodeSlices(t *testing.T) {
-	type T struct {
-		S []string
-	}
-	for i, tt := range []struct {
-		v     T
-		input string
-		want  T
-	}{
-		{T{}, "", T{}},
-		{T{[]string{}}, "", T{[]string{}}},
-		{T{[]string{"a", "b"}}, "", T{[]string{"a", "b"}}},
-		{T{}, "S = []", T{[]string{}}},
-		{T{[]string{}}, "S = []", T{[]string{}}},
-		{T{[]string{"a", "b"}}, "S = []", T{[]string{}}},
-		{T{}, `S = ["x"]`, T{[]string{"x"}}},
-		{T{[]string{}}, `S = ["x"]`, T{[]string{"x"}}},
-		{T{[]string{"a", "b"}}, `S = ["x"]`, T{[]string{"x"}}},
-	} {
-		if _, err := Decode(tt.input, &tt.v); err != nil {
-			t.Errorf("[%d] %s", i, err)
-			continue
-		}
-		if !reflect.DeepEqual(tt.v, tt.want) {
-			t.Errorf("[%d] got %#v; want %#v", i, tt.v, tt.want)
+	var x struct {
+		Tbl struct {
+			A string
+			B LocalTime
 		}
+		Ldt LocalDatetime
+		Dt  time.Time
+	}
+	if _, err := dec.Decode(&x); err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestDecodePrimitive(t *testing.T) {
-	type S struct {
-		P Primitive
+	if want := "\x1b[1mA\u00e9"; x.Tbl.A != want {
+		t.Errorf("a: want %q, got %q", want, x.Tbl.A)
 	}
-	type T struct {
-		S []int
+	if want := (LocalTime{Hour: 7, Minute: 32}); x.Tbl.B != want {
+		t.Errorf("b: want %v, got %v", want, x.Tbl.B)
 	}
-	slicep := func(s []int) *[]int { return &s }
-	arrayp := func(a [2]int) *[2]int { return &a }
-	mapp := func(m map[string]int) *map[string]int { return &m }
-	for i, tt := range []struct {
-		v     interface{}
-		input string
-		want  interface{}
-	}{
-		// slices
-		{slicep(nil), "", slicep(nil)},
-		{slicep([]int{}), "", slicep([]int{})},
-		{slicep([]int{1, 2, 3}), "", slicep([]int{1, 2, 3})},
-		{slicep(nil), "P = [1,2]", slicep([]int{1, 2})},
-		{slicep([]int{}), "P = [1,2]", slicep([]int{1, 2})},
-		{slicep([]int{1, 2, 3}), "P = [1,2]", slicep([]int{1, 2})},
+	if want := "1979-05-27T07:32:00"; x.Ldt.String() != want {
+		t.Errorf("ldt: want %v, got %v", want, x.Ldt)
+	}
+	if want := time.Date(1979, 5, 27, 14, 32, 0, 0, time.UTC); !x.Dt.Equal(want) {
+		t.Errorf("dt: want %v, got %v", want, x.Dt)
+	}
+}
 
-		// arrays
-		{arrayp([2]int{2, 3}), "", arrayp([2]int{2, 3})},
-		{arrayp([2]int{2, 3}), "P = [3,4]", arrayp([2]int{3, 4})},
+func TestDecoderTagName(t *testing.T) {
+	var x struct {
+		A string `conf:"a_key"`
+		B string `conf:"-" toml:"b"`
+		C string `toml:"c_key"`
+	}
+	dec := NewDecoder(strings.NewReader(`a_key = "a"` + "\nb = 'b'\nc = 'c'"))
+	dec.TagName("conf")
+	if _, err := dec.Decode(&x); err != nil {
+		t.Fatal(err)
+	}
+	if x.A != "a" || x.B != "" || x.C != "c" {
+		t.Errorf("wrong value: %#v", x)
+	}
+}
 
-		// maps
-		{mapp(nil), "", mapp(nil)},
-		{mapp(map[string]int{}), "", mapp(map[string]int{})},
-		{mapp(map[string]int{"a": 1}), "", mapp(map[string]int{"a": 1})},
-		{mapp(nil), "[P]\na = 2", mapp(map[string]int{"a": 2})},
-		{mapp(map[string]int{}), "[P]\na = 2", mapp(map[string]int{"a": 2})},
-		{mapp(map[string]int{"a": 1, "b": 3}), "[P]\na = 2", mapp(map[string]int{"a": 2, "b": 3})},
+func TestDecoderTimeLocation(t *testing.T) {
+	loc := time.FixedZone("X", 3600)
+	var x struct{ A, B, C time.Time }
+	dec := NewDecoder(strings.NewReader(
+		"a = 1979-05-27T07:32:00\nb = 1979-05-27\nc = 1979-05-27T07:32:00Z"))
+	dec.TimeLocation(loc)
+	if _, err := dec.Decode(&x); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(1979, 5, 27, 7, 32, 0, 0, loc); !x.A.Equal(want) || x.A.Location() != loc {
+		t.Errorf("a: want %v, got %v", want, x.A)
+	}
+	if want := time.Date(1979, 5, 27, 0, 0, 0, 0, loc); !x.B.Equal(want) {
+		t.Errorf("b: want %v, got %v", want, x.B)
+	}
+	if x.C.Location() != time.UTC {
+		t.Errorf("c: wrong location: %v", x.C.Location())
+	}
+}
 
-		// structs
-		{&T{nil}, "[P]", &T{nil}},
-		{&T{[]int{}}, "[P]", &T{[]int{}}},
-		{&T{[]int{1, 2, 3}}, "[P]", &T{[]int{1, 2, 3}}},
-		{&T{nil}, "[P]\nS = [1,2]", &T{[]int{1, 2}}},
-		{&T{[]int{}}, "[P]\nS = [1,2]", &T{[]int{1, 2}}},
-		{&T{[]int{1, 2, 3}}, "[P]\nS = [1,2]", &T{[]int{1, 2}}},
-	} {
-		var s S
-		md, err := Decode(tt.input, &s)
-		if err != nil {
-			t.Errorf("[%d] Decode error: %s", i, err)
-			continue
+func TestDecoderHook(t *testing.T) {
+	var x struct {
+		Timeout time.Duration
+		Retries int
+		Tags    []string
+	}
+	dec := NewDecoder(strings.NewReader("timeout = '1m30s'\nretries = 3\ntags = 'a,b'"))
+	var keys []string
+	dec.Hook(func(key Key, data interface{}, typ reflect.Type) (interface{}, error) {
+		keys = append(keys, key.String())
+		return data, nil
+	})
+	dec.Hook(func(key Key, data interface{}, typ reflect.Type) (interface{}, error) {
+		s, ok := data.(string)
+		if !ok {
+			return data, nil
 		}
-		if err := md.PrimitiveDecode(s.P, tt.v); err != nil {
-			t.Errorf("[%d] PrimitiveDecode error: %s", i, err)
-			continue
+		switch typ {
+		case reflect.TypeOf(time.Duration(0)):
+			return time.ParseDuration(s)
+		case reflect.TypeOf([]string{}):
+			return strings.Split(s, ","), nil
 		}
-		if !reflect.DeepEqual(tt.v, tt.want) {
-			t.Errorf("[%d] got %#v; want %#v", i, tt.v, tt.want)
+		return data, nil
+	})
+	if _, err := dec.Decode(&x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Timeout != 90*time.Second || x.Retries != 3 || !reflect.DeepEqual(x.Tags, []string{"a", "b"}) {
+		t.Errorf("wrong value: %#v", x)
+	}
+	sort.Strings(keys)
+	if want := []string{"", "retries", "tags", "timeout"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("wrong keys\nhave: %q\nwant: %q", keys, want)
+	}
+
+	dec = NewDecoder(strings.NewReader("timeout = 'x'"))
+	dec.Hook(func(key Key, data interface{}, typ reflect.Type) (interface{}, error) {
+		if s, ok := data.(string); ok && typ == reflect.TypeOf(time.Duration(0)) {
+			return time.ParseDuration(s)
 		}
+		return data, nil
+	})
+	_, err := dec.Decode(&x)
+	var dErr DecodeError
+	if !errors.As(err, &dErr) || dErr.Key.String() != "timeout" || !errorContains(err, "invalid duration") {
+		t.Errorf("wrong error: %v", err)
 	}
 }
 
-func TestDecodeErrors(t *testing.T) {
+func TestDecoderLimits(t *testing.T) {
 	tests := []struct {
 		in      string
+		limits  Limits
 		wantErr string
-		lastKey bool
 	}{
-		{`x`, "unexpected EOF; expected key separator '='", false},
-		{`x  `, "unexpected EOF; expected key separator '='", true},
-		{`x="`, `unexpected EOF; expected '"'`, true},
-		{`x="""`, `unexpected EOF; expected '"""'`, true},
-		{`x='`, `unexpected EOF; expected "'"`, true},
-		{`x='''`, `unexpected EOF; expected "'''"`, true},
-		{"x = ", "unexpected EOF; expected value", true},
-		{"x = \n", "expected value but found '\\n' instead", true},
-
-		// Cases found by fuzzing in #155 and #239
-		{`""` + "\ufffd", "invalid UTF-8", false},
-		{`""=` + "\ufffd", "invalid UTF-8", false},
-		{`x="""`, "unexpected EOF", true},
-		{`x = [{ key = 42 #`, "expected a comma or an inline table terminator", true},
-		{`x = {a = 42 #`, "expected a comma or an inline table terminator '}', but got end of file instead", true},
-		{`x = [42 #`, "expected a comma or array terminator ']', but got end of file instead", false},
-
-		// Literal escape characters are not alllowed in any strings
-		{`x = """` + "\r" + `"""`, `control characters are not allowed`, true},
-		{`x = """` + "\x01" + `"""`, `control characters are not allowed`, true},
-		{`x = '''` + "\r" + `'''`, `control characters are not allowed`, true},
-		{`x = '''` + "\x01" + `'''`, `control characters are not allowed`, true},
-		{`x = "` + "\r" + `"`, `control characters are not allowed`, true},
-		{`x = "` + "\x01" + `"`, `control characters are not allowed`, true},
-		{`x = '` + "\r" + `'`, `control characters are not allowed`, true},
-		{`x = '` + "\x01" + `'`, `control characters are not allowed`, true},
+		{"a = 1", Limits{MaxBytes: 5}, ""},
+		{"a = 12", Limits{MaxBytes: 5}, "document is larger than 5 bytes"},
+		{"a.b = [[1]]", Limits{MaxDepth: 4}, ""},
+		{"a.b = [[[1]]]", Limits{MaxDepth: 4}, "nesting is deeper than 4 levels"},
+		{"[a.b.c]\nd = 1", Limits{MaxDepth: 3}, "nesting is deeper than 3 levels"},
+		{"a = {b = {c = {d = 1}}}", Limits{MaxDepth: 3}, "nesting is deeper than 3 levels"},
+		{"a = [{b = [1]}]", Limits{MaxDepth: 3}, "nesting is deeper than 3 levels"},
+		{"a = 1\nb = 2\n[c]", Limits{MaxKeys: 3}, ""},
+		{"a = 1\nb = 2\n[c]\nd = 1", Limits{MaxKeys: 3}, "document has more than 3 keys"},
+		{"[[a]]\n[[a]]\n[[a]]\n[[a]]", Limits{MaxKeys: 3}, "document has more than 3 keys"},
 	}
-
 	for _, tt := range tests {
-		t.Run("", func(t *testing.T) {
-			var x struct{}
-			_, err := Decode(tt.in, &x)
-			if err == nil {
-				t.Fatal("err is nil")
-			}
+		t.Run(tt.in, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.in))
+			dec.Limits(tt.limits)
+			var x interface{}
+			_, err := dec.Decode(&x)
 			if !errorContains(err, tt.wantErr) {
-				t.Errorf("wrong error\nhave: %q\nwant: %q", err, tt.wantErr)
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
 			}
-			if tt.lastKey && !errorContains(err, "last key parsed 'x") {
-				t.Errorf("last key parsed not in error\nhave: %q\nwant: %q", err, "last key parsed 'x'")
+			if err != nil && !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("error is not ErrLimitExceeded: %v", err)
 			}
 		})
 	}
 }
 
-func TestDecodeMultilineNewlines(t *testing.T) {
+func TestDecoderExpandEnv(t *testing.T) {
+	env := map[string]string{"HOME": "/home/toml", "EMPTY": "", "X_1": "x"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
 	tests := []struct {
-		in   string
-		want string
+		in      string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{`a = "${HOME}/.config"`, map[string]interface{}{"a": "/home/toml/.config"}, ""},
+		{`a = "${X_1}${X_1} ${HOME}"`, map[string]interface{}{"a": "xx /home/toml"}, ""},
+		{`a = "${EMPTY}"`, map[string]interface{}{"a": ""}, ""},
+		{`a = "${EMPTY:-def}-${UNSET:-}-${UNSET:-a b}"`, map[string]interface{}{"a": "def--a b"}, ""},
+		{`a = "$${HOME} $HOME $$"`, map[string]interface{}{"a": "${HOME} $HOME $$"}, ""},
+		{`a = '${HOME}'`, map[string]interface{}{"a": "${HOME}"}, ""},
+		{"a = '''${HOME}'''", map[string]interface{}{"a": "${HOME}"}, ""},
+		{`"${HOME}" = 1`, map[string]interface{}{"${HOME}": int64(1)}, ""},
+		{"a = \"\"\"\n${HOME}\"\"\"", map[string]interface{}{"a": "/home/toml"}, ""},
+		{`a = ["${HOME}", {b = "${X_1}"}]`, map[string]interface{}{
+			"a": []interface{}{"/home/toml", map[string]interface{}{"b": "x"}}}, ""},
+
+		{"a = 1\n[t]\nb = [\"x\", \"${UNSET}\"]",
+			nil, `line 3, column 12 (last key parsed 't.b'): environment variable "UNSET" isn't set`},
+		{`a = "${HOME"`, nil, "unterminated ${ in string"},
+		{`a = "${}"`, nil, `invalid environment variable name ""`},
+		{`a = "${1X}"`, nil, `invalid environment variable name "1X"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.in))
+			dec.ExpandEnv(lookup)
+			var have map[string]interface{}
+			_, err := dec.Decode(&have)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", have, tt.want)
+			}
+		})
+	}
+
+	var x struct{ A string }
+	_, err := Decode(`a = "${HOME}"`, &x)
+	if err != nil || x.A != "${HOME}" {
+		t.Errorf("expanded without ExpandEnv: %q, %v", x.A, err)
+	}
+
+	dec := NewDecoder(strings.NewReader(`a = "${UNSET}"`))
+	dec.ExpandEnv(lookup)
+	_, err = dec.Decode(&x)
+	if !errors.Is(err, ErrUndefinedVar) {
+		t.Errorf("error is not ErrUndefinedVar: %v", err)
+	}
+}
+
+func TestDecoderExpandRefs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{"[paths]\nroot = '/srv'\nlogs = \"${paths.root}/logs\"\n", map[string]interface{}{
+			"paths": map[string]interface{}{"root": "/srv", "logs": "/srv/logs"}}, ""},
+		{"a = \"${b}/x\"\nb = \"${c}/y\"\nc = 'z'", map[string]interface{}{
+			"a": "z/y/x", "b": "z/y", "c": "z"}, ""},
+		{"a = [\"${t.b}\", {c = \"${t.b}!\"}]\nt = {b = 'x'}", map[string]interface{}{
+			"a": []interface{}{"x", map[string]interface{}{"c": "x!"}}, "t": map[string]interface{}{"b": "x"}}, ""},
+		{"c = 'x'\n[[a]]\nb = \"${c}\"\n[[a]]\nb = \"$${c}\"\n[d]\nc = 1", map[string]interface{}{
+			"a": []map[string]interface{}{{"b": "x"}, {"b": "${c}"}}, "c": "x", "d": map[string]interface{}{"c": int64(1)}}, ""},
+		{"a = \"${b:-def}\"\nb = ''", map[string]interface{}{"a": "def", "b": ""}, ""},
+
+		{"a = \"${b}\"", nil, `line 1, column 6 (last key parsed 'a'): undefined reference "b"`},
+		{"a = \"${b}\"\nb = 1", nil, `line 1, column 6 (last key parsed 'a'): reference to "b", which is an integer rather than a string`},
+		{"a = \"${b}\"\n[b]", nil, `reference to "b", which is a table rather than a string`},
+		{"a = \"${b}\"\nb = \"${c}\"\nc = \"${a}\"", nil,
+			`line 1, column 6 (last key parsed 'a'): reference cycle: a -> b -> c -> a`},
+		{"[t]\na = \"x${t.a}\"", nil, `line 2, column 6 (last key parsed 't.a'): reference cycle: t.a -> t.a`},
+		{"a = \"${'b'}\"", nil, `invalid reference "'b'"`},
+		{"a = \"${b.}\"", nil, `invalid reference "b."`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.in))
+			dec.ExpandRefs()
+			var have map[string]interface{}
+			_, err := dec.Decode(&have)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("env", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader("home = '/root'\na = \"${home}:${HOME}:${PORT:-80}\"\nb = \"${UNSET}\""))
+		dec.ExpandRefs()
+		dec.ExpandEnv(func(name string) (string, bool) {
+			if name == "HOME" || name == "home" {
+				return "/home/toml", true
+			}
+			return "", false
+		})
+		var have struct{ A string }
+		_, err := dec.Decode(&have)
+		want := `"UNSET" isn't a key in the document or an environment variable`
+		if !errorContains(err, want) {
+			t.Fatalf("wrong error\nhave: %v\nwant: %q", err, want)
+		}
+		if !errors.Is(err, ErrUndefinedVar) {
+			t.Errorf("error is not ErrUndefinedVar: %v", err)
+		}
+	})
+
+	for _, in := range []string{"a = \"${b}\"\nb = 1", "a = \"${a}\""} {
+		dec := NewDecoder(strings.NewReader(in))
+		dec.ExpandRefs()
+		_, err := dec.Decode(&map[string]interface{}{})
+		if !errors.Is(err, ErrReference) {
+			t.Errorf("error is not ErrReference: %v", err)
+		}
+	}
+}
+
+func TestDecoderIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"main.toml": "include = ['base.toml', 'secrets/*.toml']\nname = 'main'\nlogs = \"${paths.root}/logs\"\n" +
+			"[db]\nport = 6543\n",
+		"base.toml":      "name = 'base'\nservers = [1, 2]\n[paths]\nroot = '/srv'\n[db]\nhost = 'localhost'\nport = 5432\n",
+		"secrets/b.toml": "[db]\npassword = 'b'\nuser = 'u'",
+		"secrets/a.toml": "[db]\npassword = 'a'\nservers = 'x'",
+
+		"cycle.toml":      "include = 'sub/cycle.toml'",
+		"sub/cycle.toml":  "include = ['../cycle.toml']",
+		"missing.toml":    "a = 1\ninclude = ['nope.toml']",
+		"int.toml":        "include = 1",
+		"syntax.toml":     "include = ['sub/syntax.toml']",
+		"sub/syntax.toml": "a = 1\nb = ",
+		"type.toml":       "include = ['sub/type.toml']",
+		"sub/type.toml":   "[db]\nport = 'x'",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decode := func(name string, v interface{}) (MetaData, error) {
+		dec := NewDecoder(nil)
+		dec.Includes()
+		dec.ExpandRefs()
+		return dec.DecodeFile(filepath.Join(dir, name), v)
+	}
+
+	var have map[string]interface{}
+	meta, err := decode("main.toml", &have)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":    "main",
+		"logs":    "/srv/logs",
+		"servers": []interface{}{int64(1), int64(2)},
+		"paths":   map[string]interface{}{"root": "/srv"},
+		"db": map[string]interface{}{
+			"host": "localhost", "port": int64(6543), "password": "b", "user": "u", "servers": "x",
+		},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+	if meta.IsDefined("include") || !meta.IsDefined("db", "password") {
+		t.Errorf("wrong keys: %v", meta.Keys())
+	}
+
+	tests := []struct {
+		file    string
+		wantErr string
+		kinds   []error
+	}{
+		{"cycle.toml", filepath.Join(dir, "sub/cycle.toml") + ": line 1, column 11 (last key parsed 'include'): include cycle: " +
+			filepath.Join(dir, "cycle.toml") + " -> " + filepath.Join(dir, "sub/cycle.toml") + " -> " + filepath.Join(dir, "cycle.toml"),
+			[]error{ErrInclude}},
+		{"missing.toml", filepath.Join(dir, "missing.toml") + ": line 2, column 11 (last key parsed 'include'): can't include: open " +
+			filepath.Join(dir, "nope.toml"),
+			[]error{ErrInclude, os.ErrNotExist}},
+		{"int.toml", "include must be a string or an array of strings, not an integer", []error{ErrInclude}},
+		{"syntax.toml", filepath.Join(dir, "sub/syntax.toml") + ": line 2, column 5", []error{ErrSyntax}},
+		{"type.toml", "toml: " + filepath.Join(dir, "sub/type.toml") + ": line 2, column 9: key 'db.port': cannot load TOML value of type string",
+			[]error{ErrTypeMismatch}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			var x struct{ DB struct{ Port int } }
+			_, err := decode(tt.file, &x)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			for _, kind := range tt.kinds {
+				if !errors.Is(err, kind) {
+					t.Errorf("error is not %v: %v", kind, err)
+				}
+			}
+		})
+	}
+
+	// Only with Includes.
+	var x map[string]interface{}
+	_, err = DecodeFile(filepath.Join(dir, "int.toml"), &x)
+	if err != nil || x["include"] != int64(1) {
+		t.Errorf("include without Includes(): %v, %v", x, err)
+	}
+
+	// Paths with the OS's separator aren't patterns.
+	if hasMeta(filepath.Join("a", "b.toml")) || !hasMeta(filepath.Join("a", "*.toml")) {
+		t.Error("wrong hasMeta()")
+	}
+}
+
+func TestDecoderDisallowUnknownFields(t *testing.T) {
+	type config struct {
+		Name    string
+		Timeout int
+		Any     interface{}
+		Prim    Primitive
+		Date    LocalDate
+		Server  struct{ Host string }
+		Map     map[string]string
+		Plugins map[string]struct{ Path string }
+	}
+	tests := []struct {
+		in      string
+		allow   []string
+		wantErr string
+	}{
+		{"name = 'x'\nmap = {a = 'b'}", nil, ""},
+		{"any = {a = {b = 1}}\nprim = {c = 1}\ndate = 1979-05-27", nil, ""},
+		{"[server]\nhost = 'h'", nil, ""},
+		{"nam = 'x'", nil,
+			"toml: line 1, column 8: key 'nam': unknown field; did you mean 'Name'?"},
+		{"timout = 1", nil,
+			"toml: line 1, column 10: key 'timout': unknown field; did you mean 'Timeout'?"},
+		{"name = 'x'\nport = 1\n[server]\nhost = 'h'\nhots = 'x'\nport = 2", nil, "" +
+			"toml: line 2, column 8: key 'port': unknown field\n" +
+			"toml: line 5, column 9: key 'server.hots': unknown field; did you mean 'Host'?\n" +
+			"toml: line 6, column 8: key 'server.port': unknown field; did you mean 'Host'?"},
+		{"[[other]]\nx = 1\n[[other]]\nx = 2", nil,
+			"toml: line 3, column 3: key 'other': unknown field"},
+		{"[plugins.a]\npath = 'p'\nargs = ['x']", nil,
+			"toml: line 3, column 8: key 'plugins.a.args': unknown field"},
+		{"[plugins.a]\npath = 'p'\nargs = ['x']", []string{"plugins.*"}, ""},
+		{"[extra.a]\nx = 1\n[extra.b]\ny = 2", []string{"extra"}, ""},
+		{"[extra.a]\nx = 1\n[extra.b]\ny = 2", []string{"extra.*.x"},
+			"toml: line 4, column 5: key 'extra.b.y': unknown field"},
+		{"[server]\nport = 1", []string{"*.port"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.in))
+			dec.DisallowUnknownFields(tt.allow...)
+			var c config
+			_, err := dec.Decode(&c)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("wrong error\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+			if !errors.Is(err, ErrUnknownField) {
+				t.Errorf("error is not ErrUnknownField: %v", err)
+			}
+			var errs DecodeErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("error is not DecodeErrors: %T", err)
+			}
+		})
+	}
+}
+
+func TestDecoderCaseSensitive(t *testing.T) {
+	type config struct {
+		Name  string
+		Other string `toml:"other"`
+	}
+	tests := []struct {
+		in            string
+		caseSensitive bool
+		want          config
+		wantErr       string
+	}{
+		{"name = 'a'\nother = 'b'", false, config{Name: "a", Other: "b"}, ""},
+		{"NAME = 'a'\nOther = 'b'", false, config{Name: "a", Other: "b"}, ""},
+		{"name = 'a'\nother = 'b'", true, config{Other: "b"}, ""},
+		{"Name = 'a'\nOther = 'b'", true, config{Name: "a"}, ""},
+		{"Name = 'a'\nname = 'b'", false, config{},
+			"toml: line 2, column 9: key 'name': keys 'Name' and 'name' both match field toml.config.Name"},
+		{"name = 'a'\nNAME = 'b'", false, config{},
+			"toml: line 2, column 9: key 'NAME': keys 'name' and 'NAME' both match field toml.config.Name"},
+		{"Name = 'a'\nname = 'b'", true, config{Name: "a"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.in))
+			if tt.caseSensitive {
+				dec.CaseSensitive()
+			}
+			var c config
+			_, err := dec.Decode(&c)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrDuplicateKey) {
+					t.Errorf("error is not ErrDuplicateKey: %v", err)
+				}
+				return
+			}
+			if c != tt.want {
+				t.Errorf("\nhave: %#v\nwant: %#v", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"timeout", "timeout", 0},
+		{"timout", "timeout", 1},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+	}
+	for _, tt := range tests {
+		if have := levenshtein(tt.a, tt.b); have != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d; want %d", tt.a, tt.b, have, tt.want)
+		}
+	}
+}
+
+type menu struct {
+	Dishes map[string]dish
+}
+
+func (m *menu) UnmarshalTOML(p interface{}) error {
+	m.Dishes = make(map[string]dish)
+	data, _ := p.(map[string]interface{})
+	dishes := data["dishes"].(map[string]interface{})
+	for n, v := range dishes {
+		if d, ok := v.(map[string]interface{}); ok {
+			nd := dish{}
+			nd.UnmarshalTOML(d)
+			m.Dishes[n] = nd
+		} else {
+			return fmt.Errorf("not a dish")
+		}
+	}
+	return nil
+}
+
+type dish struct {
+	Name        string
+	Price       float32
+	Ingredients []ingredient
+}
+
+func (d *dish) UnmarshalTOML(p interface{}) error {
+	data, _ := p.(map[string]interface{})
+	d.Name, _ = data["name"].(string)
+	d.Price, _ = data["price"].(float32)
+	ingredients, _ := data["ingredients"].([]map[string]interface{})
+	for _, e := range ingredients {
+		n, _ := interface{}(e).(map[string]interface{})
+		name, _ := n["name"].(string)
+		i := ingredient{name}
+		d.Ingredients = append(d.Ingredients, i)
+	}
+	return nil
+}
+
+type ingredient struct {
+	Name string
+}
+
+func TestDecodeSlices(t *testing.T) {
+	type T struct {
+		S []string
+	}
+	for i, tt := range []struct {
+		v     T
+		input string
+		want  T
+	}{
+		{T{}, "", T{}},
+		{T{[]string{}}, "", T{[]string{}}},
+		{T{[]string{"a", "b"}}, "", T{[]string{"a", "b"}}},
+		{T{}, "S = []", T{[]string{}}},
+		{T{[]string{}}, "S = []", T{[]string{}}},
+		{T{[]string{"a", "b"}}, "S = []", T{[]string{}}},
+		{T{}, `S = ["x"]`, T{[]string{"x"}}},
+		{T{[]string{}}, `S = ["x"]`, T{[]string{"x"}}},
+		{T{[]string{"a", "b"}}, `S = ["x"]`, T{[]string{"x"}}},
+	} {
+		if _, err := Decode(tt.input, &tt.v); err != nil {
+			t.Errorf("[%d] %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.v, tt.want) {
+			t.Errorf("[%d] got %#v; want %#v", i, tt.v, tt.want)
+		}
+	}
+}
+
+func TestDecodePrimitive(t *testing.T) {
+	type S struct {
+		P Primitive
+	}
+	type T struct {
+		S []int
+	}
+	slicep := func(s []int) *[]int { return &s }
+	arrayp := func(a [2]int) *[2]int { return &a }
+	mapp := func(m map[string]int) *map[string]int { return &m }
+	for i, tt := range []struct {
+		v     interface{}
+		input string
+		want  interface{}
+	}{
+		// slices
+		{slicep(nil), "", slicep(nil)},
+		{slicep([]int{}), "", slicep([]int{})},
+		{slicep([]int{1, 2, 3}), "", slicep([]int{1, 2, 3})},
+		{slicep(nil), "P = [1,2]", slicep([]int{1, 2})},
+		{slicep([]int{}), "P = [1,2]", slicep([]int{1, 2})},
+		{slicep([]int{1, 2, 3}), "P = [1,2]", slicep([]int{1, 2})},
+
+		// arrays
+		{arrayp([2]int{2, 3}), "", arrayp([2]int{2, 3})},
+		{arrayp([2]int{2, 3}), "P = [3,4]", arrayp([2]int{3, 4})},
+
+		// maps
+		{mapp(nil), "", mapp(nil)},
+		{mapp(map[string]int{}), "", mapp(map[string]int{})},
+		{mapp(map[string]int{"a": 1}), "", mapp(map[string]int{"a": 1})},
+		{mapp(nil), "[P]\na = 2", mapp(map[string]int{"a": 2})},
+		{mapp(map[string]int{}), "[P]\na = 2", mapp(map[string]int{"a": 2})},
+		{mapp(map[string]int{"a": 1, "b": 3}), "[P]\na = 2", mapp(map[string]int{"a": 2, "b": 3})},
+
+		// structs
+		{&T{nil}, "[P]", &T{nil}},
+		{&T{[]int{}}, "[P]", &T{[]int{}}},
+		{&T{[]int{1, 2, 3}}, "[P]", &T{[]int{1, 2, 3}}},
+		{&T{nil}, "[P]\nS = [1,2]", &T{[]int{1, 2}}},
+		{&T{[]int{}}, "[P]\nS = [1,2]", &T{[]int{1, 2}}},
+		{&T{[]int{1, 2, 3}}, "[P]\nS = [1,2]", &T{[]int{1, 2}}},
+	} {
+		var s S
+		md, err := Decode(tt.input, &s)
+		if err != nil {
+			t.Errorf("[%d] Decode error: %s", i, err)
+			continue
+		}
+		if err := md.PrimitiveDecode(s.P, tt.v); err != nil {
+			t.Errorf("[%d] PrimitiveDecode error: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.v, tt.want) {
+			t.Errorf("[%d] got %#v; want %#v", i, tt.v, tt.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr string
+		lastKey bool
+	}{
+		{`x`, "unexpected EOF; expected key separator '='", false},
+		{`x  `, "unexpected EOF; expected key separator '='", true},
+		{`x="`, `unexpected EOF; expected '"'`, true},
+		{`x="""`, `unexpected EOF; expected '"""'`, true},
+		{`x='`, `unexpected EOF; expected "'"`, true},
+		{`x='''`, `unexpected EOF; expected "'''"`, true},
+		{"x = ", "unexpected EOF; expected value", true},
+		{"x = \n", "expected value but found '\\n' instead", true},
+
+		// Cases found by fuzzing in #155 and #239
+		{`""` + "\ufffd", "invalid UTF-8", false},
+		{`""=` + "\ufffd", "invalid UTF-8", false},
+		{`x="""`, "unexpected EOF", true},
+		{`x = [{ key = 42 #`, "expected a comma or an inline table terminator", true},
+		{`x = {a = 42 #`, "expected a comma or an inline table terminator '}', but got end of file instead", true},
+		{`x = [42 #`, "expected a comma or array terminator ']', but got end of file instead", false},
+
+		// Literal escape characters are not alllowed in any strings
+		{`x = """` + "\r" + `"""`, `control characters are not allowed`, true},
+		{`x = """` + "\x01" + `"""`, `control characters are not allowed`, true},
+		{`x = '''` + "\r" + `'''`, `control characters are not allowed`, true},
+		{`x = '''` + "\x01" + `'''`, `control characters are not allowed`, true},
+		{`x = "` + "\r" + `"`, `control characters are not allowed`, true},
+		{`x = "` + "\x01" + `"`, `control characters are not allowed`, true},
+		{`x = '` + "\r" + `'`, `control characters are not allowed`, true},
+		{`x = '` + "\x01" + `'`, `control characters are not allowed`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var x struct{}
+			_, err := Decode(tt.in, &x)
+			if err == nil {
+				t.Fatal("err is nil")
+			}
+			if !errorContains(err, tt.wantErr) {
+				t.Errorf("wrong error\nhave: %q\nwant: %q", err, tt.wantErr)
+			}
+			if tt.lastKey && !errorContains(err, "last key parsed 'x") {
+				t.Errorf("last key parsed not in error\nhave: %q\nwant: %q", err, "last key parsed 'x'")
+			}
+		})
+	}
+}
+
+func TestDecodeMultilineNewlines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
 	}{
 		// Note "NL" gets replaced by "\n" and "\r\n" (the tests are run twice);
 		// this makes it easier to read and write these tests.
 
-		{`x = """"""`, ``},
-		{`x = """\NL"""`, ``},       // Empty string
-		{`x = """\NL\NL\NL"""`, ``}, // Empty string
+		{`x = """"""`, ``},
+		{`x = """\NL"""`, ``},       // Empty string
+		{`x = """\NL\NL\NL"""`, ``}, // Empty string
+
+		{`x = """a\NL    u2222b"""`, `au2222b`},     // Remove all whitespace after \
+		{`x = """a\NLNLNLu2222b"""`, `au2222b`},     // Remove all newlines
+		{`x = """a  \NL    u2222b"""`, `a  u2222b`}, // Don't remove whitespace before \
+
+		{`x = """a \ NLb"""`, `a b`}, // Allow any whitespace between \n and \
+		{`x = """a  \ NL b"""`, `a  b`},
+		{`x = """a \ 		    NLb"""`, `a b`},
+
+		{`x="""a\NLu2222b"""`, `au2222b`},        // Ends in \ → remove
+		{`x="""a\\NLu2222b"""`, `a\NLu2222b`},    // Ends in \\ → literal backslash, so keep NL.
+		{`x="""a\\\NLu2222b"""`, `a\u2222b`},     // Ends in \\\ → backslash followed by NL escape, so remove.
+		{`x="""a\\\\NLu2222b"""`, `a\\NLu2222b`}, // Ends in \\\\ → two lieral backslashes; keep NL
+
+		{`x = """NLa b \n cNLd e fNL"""`, "a b \n c\nd e f\n"},
+		{`x = """a b c\NL"""`, "a b c"},
+
+		{`x = """NLThe quick brown \NLNLNLfox jumps over \NL    the lazy dog."""`,
+			`The quick brown fox jumps over the lazy dog.`},
+		{`x = """\NL        The quick brown \NLNLNL        fox jumps over \NL        the lazy dog.\NL        """`,
+			`The quick brown fox jumps over the lazy dog.`},
+	}
+
+	replUnix := strings.NewReplacer("NL", "\n")
+	replWin := strings.NewReplacer("NL", "\r\n")
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			t.Run("unix", func(t *testing.T) {
+				in := replUnix.Replace(tt.in)
+				want := replUnix.Replace(tt.want)
+
+				var s struct{ X string }
+				_, err := Decode(in, &s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.X != want {
+					t.Errorf("\nhave: %q\nwant: %q", s.X, want)
+				}
+			})
+
+			t.Run("windows", func(t *testing.T) {
+				in := replWin.Replace(tt.in)
+				want := replWin.Replace(tt.want)
+
+				var s struct{ X string }
+				_, err := Decode(in, &s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.X != want {
+					t.Errorf("\nhave: %q\nwant: %q", s.X, want)
+				}
+			})
+		})
+	}
+}
+
+// Test for https://github.com/BurntSushi/toml/pull/166.
+func TestDecodeBoolArray(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		got  interface{}
+		want interface{}
+	}{
+		{
+			"a = [true, false]",
+			&struct{ A []bool }{},
+			&struct{ A []bool }{[]bool{true, false}},
+		},
+		{
+			"a = {a = true, b = false}",
+			&struct{ A map[string]bool }{},
+			&struct{ A map[string]bool }{map[string]bool{"a": true, "b": false}},
+		},
+	} {
+		if _, err := Decode(tt.s, tt.got); err != nil {
+			t.Errorf("Decode(%q): %s", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("Decode(%q): got %#v; want %#v", tt.s, tt.got, tt.want)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	var testSimple = `
+age = 250
+andrew = "gallant"
+kait = "brady"
+now = 1987-07-05T05:45:00Z
+nowEast = 2017-06-22T16:15:21+08:00
+nowWest = 2017-06-22T02:14:36-06:00
+yesOrNo = true
+pi = 3.14
+colors = [
+	["red", "green", "blue"],
+	["cyan", "magenta", "yellow", "black"],
+]
+
+[My.Cats]
+plato = "cat 1"
+cauchy = """ cat 2
+"""
+`
+
+	type cats struct {
+		Plato  string
+		Cauchy string
+	}
+	type simple struct {
+		Age     int
+		Colors  [][]string
+		Pi      float64
+		YesOrNo bool
+		Now     time.Time
+		NowEast time.Time
+		NowWest time.Time
+		Andrew  string
+		Kait    string
+		My      map[string]cats
+	}
+
+	var val simple
+	_, err := Decode(testSimple, &val)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Decode(testSimple, &val)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	file :=
+		`a = "a"
+b = "b"
+c = 001  # invalid
+`
+
+	var s struct {
+		A, B string
+		C    int
+	}
+	_, err := Decode(file, &s)
+	if err == nil {
+		t.Fatal("err is nil")
+	}
+
+	var pErr ParseError
+	if !errors.As(err, &pErr) {
+		t.Fatalf("err is not a ParseError: %T %[1]v", err)
+	}
+
+	want := ParseError{
+		Line:     3,
+		Position: Position{Line: 3, Col: 5, Start: 20, Len: 3},
+		LastKey:  "c",
+		Message:  `Invalid integer "001": cannot have leading zeroes`,
+	}
+	if !strings.Contains(pErr.Message, want.Message) ||
+		pErr.Line != want.Line ||
+		pErr.Position != want.Position ||
+		pErr.LastKey != want.LastKey {
+		t.Errorf("unexpected data\nhave: %#v\nwant: %#v", pErr, want)
+	}
+
+	wantPos := `line 3, column 5 (last key parsed 'c'): Invalid integer "001": cannot have leading zeroes
+
+      2 | b = "b"
+      3 | c = 001  # invalid
+              ^^^
+`
+	if have := pErr.ErrorWithPosition(); have != wantPos {
+		t.Errorf("wrong ErrorWithPosition()\nhave:\n%s\nwant:\n%s", have, wantPos)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Position
+	}{
+		{"a = 1\nb = 2\na = 3", Position{Line: 3, Col: 1, Start: 12, Len: 1}},
+		{"a = [\n  1,\n  'x',\n  01,\n]", Position{Line: 4, Col: 3, Start: 20, Len: 2}},
+		{"a = [\n  1,\n  'x',\n  0x_1,\n]", Position{Line: 4, Col: 5, Start: 22, Len: 1}},
+		{"a = \"é\\q\"", Position{Line: 1, Col: 8, Start: 8, Len: 1}},
+		{"a = {x = 1\n}", Position{Line: 1, Col: 11, Start: 10, Len: 1}},
+		{"a = 'x", Position{Line: 1, Col: 7, Start: 6, Len: 0}},
+		{"[a]\n[b]\n[ a ]", Position{Line: 3, Col: 3, Start: 10, Len: 1}},
+		{"[[a.b]]\n[a]\nb = 1", Position{Line: 3, Col: 1, Start: 12, Len: 1}},
+		{"x.y = 1\nx . y . z = 2", Position{Line: 2, Col: 1, Start: 8, Len: 9}},
+		{"a = \"\"\"\n\n\\x\"\"\"", Position{Line: 3, Col: 2, Start: 10, Len: 1}},
+		{"a = 2006-01-30T00:00 ", Position{Line: 1, Col: 5, Start: 4, Len: 16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var x interface{}
+			_, err := Decode(tt.in, &x)
+			var pErr ParseError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("err is not a ParseError: %T %[1]v", err)
+			}
+			if pErr.Position != tt.want {
+				t.Errorf("wrong position for %q\nhave: %#v\nwant: %#v",
+					pErr.Message, pErr.Position, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorFilename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "x.toml")
+	if err := ioutil.WriteFile(file, []byte("a = 1\n\t# \x01"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var x interface{}
+	_, err = DecodeFile(file, &x)
+	want := file + ": line 2, column 4 (last key parsed ''): control characters"
+	if !errorContains(err, want) {
+		t.Fatalf("wrong error\nhave: %v\nwant: %q", err, want)
+	}
+
+	wantPos := `
+      1 | a = 1
+      2 | 	# ` + "\x01" + `
+          	  ^
+`
+	if have := err.(ParseError).ErrorWithPosition(); !strings.HasSuffix(have, wantPos) {
+		t.Errorf("wrong ErrorWithPosition()\nhave:\n%s\nwant:\n%s", have, wantPos)
+	}
+
+	// The Decoder still reads from its own reader after DecodeFile, and the
+	// errors don't have the filename.
+	dec := NewDecoder(strings.NewReader("b = 2\nc = 'x"))
+	if _, err := dec.DecodeFile(file, &x); err == nil {
+		t.Fatal("no error")
+	}
+	_, err = dec.Decode(&x)
+	if pErr, ok := err.(ParseError); !ok || pErr.Filename != "" || pErr.Position.Line != 2 {
+		t.Errorf("wrong error: %#v", err)
+	}
+
+	_, err = NewDecoder(nil).Decode(&x)
+	if !errorContains(err, "toml: Decode with a nil io.Reader") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestParseErrorAll(t *testing.T) {
+	in := `
+a = [
+  01,
+  2,
+  { b = 1 },
+]
+b = 1
+b = 2
+
+[tbl
+c = "\q"
+
+[[arr]]
+d = {e = 1
+}
+e = 1979-99-99
+f = tru
+`
+	want := []struct {
+		line int
+		msg  string
+	}{
+		{3, `Invalid integer "01"`},
+		{8, "Key 'b' has already been defined"},
+		{10, "expected '.' or ']' to end table name"},
+		{11, "invalid escape character 'q'"},
+		{14, "newlines not allowed within inline tables"},
+		{16, `Invalid TOML Datetime: "1979-99-99"`},
+		{17, "expected value but found \"tru\" instead"},
+	}
+
+	dec := NewDecoder(strings.NewReader(in))
+	dec.AllErrors()
+	var x interface{}
+	_, err := dec.Decode(&x)
+
+	var pErrs ParseErrors
+	if !errors.As(err, &pErrs) {
+		t.Fatalf("err is not ParseErrors: %T %[1]v", err)
+	}
+	if len(pErrs) != len(want) {
+		t.Fatalf("wrong number of errors: want %d, got %d\n%s",
+			len(want), len(pErrs), pErrs.ErrorWithPosition())
+	}
+	for i, w := range want {
+		if pErrs[i].Position.Line != w.line || !strings.Contains(pErrs[i].Message, w.msg) {
+			t.Errorf("error %d:\nhave: line %d: %s\nwant: line %d: %s",
+				i, pErrs[i].Position.Line, pErrs[i].Message, w.line, w.msg)
+		}
+	}
+	if !strings.HasSuffix(err.Error(), "(and 6 more errors)") {
+		t.Errorf("wrong error: %s", err)
+	}
+	if !errors.Is(err, ErrSyntax) || !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("errors.Is doesn't match the errors: %v", err)
+	}
+	if errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("errors.Is matches ErrTypeMismatch: %v", err)
+	}
+	var pErr ParseError
+	if !errors.As(err, &pErr) || pErr.Position.Line != 3 {
+		t.Errorf("errors.As doesn't set the first ParseError: %#v", pErr)
+	}
+	if x != nil {
+		t.Errorf("decoded despite errors: %#v", x)
+	}
+
+	// Still returns a single ParseError without AllErrors.
+	_, err = Decode(in, &x)
+	if _, ok := err.(ParseError); !ok {
+		t.Errorf("err is not a ParseError: %T %[1]v", err)
+	}
+
+	// No errors.
+	dec = NewDecoder(strings.NewReader("a = 1\n[tbl]\nb = 2"))
+	dec.AllErrors()
+	if _, err := dec.Decode(&x); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, map[string]interface{}{
+		"a":   int64(1),
+		"tbl": map[string]interface{}{"b": int64(2)},
+	}) {
+		t.Errorf("wrong value: %#v", x)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	type (
+		server struct {
+			Port int8
+			Tags []int
+		}
+		config struct {
+			Name    string
+			Servers []server
+			Limits  map[string]uint8
+			Nested  struct{ A struct{ B bool } }
+		}
+	)
+
+	tests := []struct {
+		in   string
+		key  string
+		pos  Position
+		want string
+	}{
+		{`name = 1`, "name", Position{Line: 1, Col: 8, Start: 7, Len: 1},
+			"toml: line 1, column 8: key 'name': cannot load TOML value of type int64 into a Go string"},
+		{"[[servers]]\nport = 1\n[[servers]]\nport = 300", "servers.port", Position{Line: 4, Col: 8, Start: 40, Len: 3},
+			"toml: line 4, column 8: key 'servers[1].port': value 300 is out of range for int8"},
+		{"[[servers]]\nport = 300\n\n[[servers]]\nport = 1", "servers.port", Position{Line: 2, Col: 8, Start: 19, Len: 3},
+			"toml: line 2, column 8: key 'servers[0].port': value 300 is out of range for int8"},
+		{"[[servers]]\ntags = [\n  1,\n  'x',\n]", "servers.tags", Position{Line: 2, Col: 8, Start: 19, Len: 1},
+			"key 'servers[0].tags[1]': cannot load TOML value of type string into a Go integer"},
+		{"limits = {a = 1, b = -1}", "limits.b", Position{Line: 1, Col: 22, Start: 21, Len: 2},
+			"key 'limits.b': value -1 is out of range for uint8"},
+		{"nested.a.b = 'x'", "nested.a.b", Position{Line: 1, Col: 15, Start: 14, Len: 1},
+			"key 'nested.a.b': cannot load TOML value of type string into a Go boolean"},
+		{"nested.a = 1", "nested.a", Position{Line: 1, Col: 12, Start: 11, Len: 1},
+			"key 'nested.a': type mismatch for struct { B bool }: expected table but found int64"},
+		{"[nested]\na = 1", "nested.a", Position{Line: 2, Col: 5, Start: 13, Len: 1},
+			"key 'nested.a': type mismatch"},
+		{"servers = 1", "servers", Position{Line: 1, Col: 11, Start: 10, Len: 1},
+			"key 'servers': cannot load TOML value of type int64 into a Go slice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var c config
+			_, err := Decode(tt.in, &c)
+
+			var dErr DecodeError
+			if !errors.As(err, &dErr) {
+				t.Fatalf("err is not a DecodeError: %T %[1]v", err)
+			}
+			if dErr.Key.String() != tt.key {
+				t.Errorf("wrong key\nhave: %q\nwant: %q", dErr.Key, tt.key)
+			}
+			if dErr.Position != tt.pos {
+				t.Errorf("wrong position\nhave: %#v\nwant: %#v", dErr.Position, tt.pos)
+			}
+			if !errorContains(err, tt.want) {
+				t.Errorf("wrong error\nhave: %s\nwant: %s", err, tt.want)
+			}
+		})
+	}
+}
+
+type textStruct struct {
+	Name string
+	Tags []string
+}
+
+func (t *textStruct) UnmarshalText(text []byte) error {
+	t.Name = string(text)
+	return nil
+}
+
+type textMap map[string]int
+
+func (t *textMap) UnmarshalText(text []byte) error {
+	*t = textMap{string(text): 0}
+	return nil
+}
+
+type textString string
+
+func (t *textString) UnmarshalText(text []byte) error {
+	*t = textString(strings.ToUpper(string(text)))
+	return nil
+}
+
+// UnmarshalText is only used for primitive values; types that can be decoded
+// from a table or array are decoded as usual from those.
+func TestDecodeTextUnmarshalerTable(t *testing.T) {
+	type config struct {
+		S    textStruct
+		SP   *textStruct
+		SS   []textStruct
+		M    textMap
+		Str  textString
+		Time time.Time
+	}
+	tests := []struct {
+		in      string
+		want    config
+		wantErr string
+	}{
+		{`s = "x"`, config{S: textStruct{Name: "x"}}, ""},
+		{`s = {name = "x", tags = ["a"]}`, config{S: textStruct{Name: "x", Tags: []string{"a"}}}, ""},
+		{"[s]\nname = 'x'", config{S: textStruct{Name: "x"}}, ""},
+		{"sp = 'x'", config{SP: &textStruct{Name: "x"}}, ""},
+		{"[sp]\nname = 'x'", config{SP: &textStruct{Name: "x"}}, ""},
+		{"ss = ['x', {name = 'y'}]", config{SS: []textStruct{{Name: "x"}, {Name: "y"}}}, ""},
+		{"[[ss]]\nname = 'x'\n[[ss]]\nname = 'y'", config{SS: []textStruct{{Name: "x"}, {Name: "y"}}}, ""},
+		{"m = 'x'", config{M: textMap{"x": 0}}, ""},
+		{"m = {a = 1}", config{M: textMap{"a": 1}}, ""},
+		{"str = 'x'", config{Str: "X"}, ""},
+		{"str = {a = 1}", config{},
+			"key 'str': cannot load TOML value of type map[string]interface {} into a Go primitive (string-like)"},
+		{"time = {a = 1}", config{},
+			"key 'time': cannot load TOML value of type map[string]interface {} into a Go primitive (string-like)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var c config
+			_, err := Decode(tt.in, &c)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(c, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeNumber(t *testing.T) {
+	in := `
+hex    = 0xDEAD_BEEF
+big    = 1e400
+pi     = 3.14159265358979323846264338
+inf    = -inf
+ints   = [1_000, 0o17]
+[tbl]
+n = 18446744073709551616
+`
+	var c struct {
+		Hex, Big, Pi, Inf Number
+		Ints              []Number
+		Tbl               map[string]Number
+	}
+	if _, err := Decode(in, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Hex != "0xDEAD_BEEF" || c.Big != "1e400" || c.Pi != "3.14159265358979323846264338" ||
+		c.Inf != "-inf" || !reflect.DeepEqual(c.Ints, []Number{"1_000", "0o17"}) ||
+		c.Tbl["n"] != "18446744073709551616" {
+		t.Errorf("wrong numbers: %#v", c)
+	}
+
+	var m map[string]interface{}
+	dec := NewDecoder(strings.NewReader(in))
+	dec.UseNumber()
+	if _, err := dec.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["hex"] != Number("0xDEAD_BEEF") || m["tbl"].(map[string]interface{})["n"] != Number("18446744073709551616") {
+		t.Errorf("wrong numbers: %#v", m)
+	}
+
+	// Hooks get an int64 or float64, but the literal is kept if they don't
+	// change it.
+	var h struct {
+		Hex Number
+		Pi  float64
+	}
+	dec = NewDecoder(strings.NewReader("hex = 0xff\npi = 3.14"))
+	dec.Hook(func(key Key, data interface{}, typ reflect.Type) (interface{}, error) {
+		if key.String() == "pi" {
+			return data.(float64) * 2, nil
+		}
+		return data, nil
+	})
+	if _, err := dec.Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Hex != "0xff" || h.Pi != 6.28 {
+		t.Errorf("wrong numbers: %#v", h)
+	}
+
+	// Numbers that are out of range are given to hooks as-is, and are only an
+	// error if they're decoded into a type that can't hold them; the first key
+	// in sorted order is reported.
+	identity := func(key Key, data interface{}, typ reflect.Type) (interface{}, error) {
+		return data, nil
+	}
+	dec = NewDecoder(strings.NewReader(in))
+	dec.Hook(identity)
+	if _, err := dec.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Big != "1e400" || c.Tbl["n"] != "18446744073709551616" {
+		t.Errorf("wrong numbers: %#v", c)
+	}
+	var u struct{ U uint64 }
+	dec = NewDecoder(strings.NewReader("u = 18446744073709551615"))
+	dec.Hook(identity)
+	if _, err := dec.Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.U != math.MaxUint64 {
+		t.Errorf("wrong number: %d", u.U)
+	}
+	dec = NewDecoder(strings.NewReader(in))
+	dec.Hook(identity)
+	_, err := dec.Decode(&map[string]interface{}{})
+	if !errors.Is(err, ErrOutOfRange) || !errorContains(err, "key 'big': number 1e400 is out of the range") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	_, err = Decode("n = 'x'", &struct{ N Number }{})
+	if !errorContains(err, "cannot load TOML value of type string into a Go number") {
+		t.Errorf("wrong error: %v", err)
+	}
+	_, err = Decode(in, &m)
+	if !errors.Is(err, ErrOutOfRange) || !errorContains(err, "key 'big': number 1e400 is out of the range") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestDecodeDefault(t *testing.T) {
+	type server struct {
+		Host string `toml:"host" default:"'localhost'"`
+		Port int    `toml:"port,default=8080"`
+	}
+	type config struct {
+		Name    string            `default:"\"app\""`
+		Tags    []string          `toml:"tags,omitempty,default=['a', 'b']"`
+		Limits  map[string]int    `default:"{cpu = 2, mem = 512}"`
+		Start   LocalDate         `default:"2021-01-02"`
+		Ratio   *float64          `default:"0.5"`
+		Server  server            `toml:"server"`
+		Servers []server          `toml:"servers"`
+		Extra   map[string]server `toml:"extra"`
+	}
+	half := 0.5
+	tests := []struct {
+		in      string
+		want    config
+		wantErr string
+	}{
+		{"", config{
+			Name:   "app",
+			Tags:   []string{"a", "b"},
+			Limits: map[string]int{"cpu": 2, "mem": 512},
+			Start:  LocalDate{2021, 1, 2},
+			Ratio:  &half,
+			Server: server{Host: "localhost", Port: 8080},
+		}, ""},
+		{"name = 'x'\ntags = []\n[server]\nport = 1\n[[servers]]\nhost = 'h'\n[extra.a]", config{
+			Name:    "x",
+			Tags:    []string{},
+			Limits:  map[string]int{"cpu": 2, "mem": 512},
+			Start:   LocalDate{2021, 1, 2},
+			Ratio:   &half,
+			Server:  server{Host: "localhost", Port: 1},
+			Servers: []server{{Host: "h", Port: 8080}},
+			Extra:   map[string]server{"a": {Host: "localhost", Port: 8080}},
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var c config
+			_, err := Decode(tt.in, &c)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(c, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", c, tt.want)
+			}
+		})
+	}
+
+	_, err := Decode("", &struct {
+		S struct {
+			N int `toml:"n" default:"x"`
+		}
+	}{})
+	if !errorContains(err, `key 'S.n': invalid default "x": expected value but found "x" instead`) || !errors.Is(err, ErrSyntax) {
+		t.Errorf("wrong error: %v", err)
+	}
+	_, err = Decode("", &struct {
+		N int `default:"'x'"`
+	}{})
+	if !errorContains(err, "key 'N': cannot load TOML value of type string into a Go integer") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestDecodeRequired(t *testing.T) {
+	type server struct {
+		Host string `toml:"host,required"`
+		Port int    `toml:"port,required"`
+		Name string `toml:"name"`
+	}
+	type config struct {
+		Name     string            `toml:"name,required"`
+		Database server            `toml:"database"`
+		Servers  []server          `toml:"servers"`
+		Extra    map[string]server `toml:"extra"`
+		Default  int               `toml:"default,required,default=1"`
+	}
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"name = 'x'\ndefault = 2\n[database]\nhost = 'h'\nport = 1", nil},
+		{"", []string{"name", "database.host", "database.port", "default"}},
+		{"name = 'x'\ndefault = 2\n[database]\nhost = 'h'\n" +
+			"[[servers]]\nhost = 'a'\nport = 1\n[[servers]]\nport = 2\n[[servers]]\n" +
+			"[extra.b]\nport = 1\n[extra.a]\nhost = 'a'",
+			[]string{"database.port", "servers[1].host", "servers[2].host", "servers[2].port",
+				"extra.a.port", "extra.b.host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var c config
+			_, err := Decode(tt.in, &c)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrMissingField) {
+				t.Fatalf("error is not ErrMissingField: %v", err)
+			}
+			var errs DecodeErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("error is not DecodeErrors: %T", err)
+			}
+			var have []string
+			for _, e := range errs {
+				have = append(have, e.Path)
+			}
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
 
-		{`x = """a\NL    u2222b"""`, `au2222b`},     // Remove all whitespace after \
-		{`x = """a\NLNLNLu2222b"""`, `au2222b`},     // Remove all newlines
-		{`x = """a  \NL    u2222b"""`, `a  u2222b`}, // Don't remove whitespace before \
+	_, err := Decode("[[servers]]\nport = 1", &struct{ Servers []server }{})
+	want := "toml: line 1, column 3: key 'servers[0].host': missing required field"
+	if err == nil || err.Error() != want {
+		t.Errorf("\nhave: %v\nwant: %s", err, want)
+	}
+}
 
-		{`x = """a \ NLb"""`, `a b`}, // Allow any whitespace between \n and \
-		{`x = """a  \ NL b"""`, `a  b`},
-		{`x = """a \ 		    NLb"""`, `a b`},
+type pool struct {
+	MinConns int `toml:"min_conns"`
+	MaxConns int `toml:"max_conns"`
+}
 
-		{`x="""a\NLu2222b"""`, `au2222b`},        // Ends in \ → remove
-		{`x="""a\\NLu2222b"""`, `a\NLu2222b`},    // Ends in \\ → literal backslash, so keep NL.
-		{`x="""a\\\NLu2222b"""`, `a\u2222b`},     // Ends in \\\ → backslash followed by NL escape, so remove.
-		{`x="""a\\\\NLu2222b"""`, `a\\NLu2222b`}, // Ends in \\\\ → two lieral backslashes; keep NL
+var validated []string
 
-		{`x = """NLa b \n cNLd e fNL"""`, "a b \n c\nd e f\n"},
-		{`x = """a b c\NL"""`, "a b c"},
+func (p *pool) ValidateTOML(md MetaData) error {
+	validated = append(validated, "pool")
+	if p.MinConns > p.MaxConns {
+		return fmt.Errorf("min_conns (%d) is larger than max_conns (%d)", p.MinConns, p.MaxConns)
+	}
+	return nil
+}
 
-		{`x = """NLThe quick brown \NLNLNLfox jumps over \NL    the lazy dog."""`,
-			`The quick brown fox jumps over the lazy dog.`},
-		{`x = """\NL        The quick brown \NLNLNL        fox jumps over \NL        the lazy dog.\NL        """`,
-			`The quick brown fox jumps over the lazy dog.`},
+type database struct {
+	Name  string
+	Pools []pool
+}
+
+func (d database) ValidateTOML(md MetaData) error {
+	validated = append(validated, "database")
+	if !md.IsDefined("database", "name") {
+		return errors.New("no name")
 	}
+	return nil
+}
 
-	replUnix := strings.NewReplacer("NL", "\n")
-	replWin := strings.NewReplacer("NL", "\r\n")
+func TestDecodeValidator(t *testing.T) {
+	type config struct {
+		Database database
+	}
+	tests := []struct {
+		in        string
+		validated []string
+		wantErr   string
+	}{
+		{"[database]\nname = 'x'\n[[database.pools]]\nmin_conns = 1\nmax_conns = 2",
+			[]string{"pool", "database"}, ""},
+		{"[database]\n[[database.pools]]", []string{"pool", "database"}, "toml: line 1, column 2: key 'database': no name"},
+		{"[database]\nname = 'x'\n[[database.pools]]\n[[database.pools]]\nmin_conns = 3\nmax_conns = 2",
+			[]string{"pool", "pool"},
+			"toml: line 4, column 3: key 'database.pools[1]': min_conns (3) is larger than max_conns (2)"},
+	}
 	for _, tt := range tests {
-		t.Run("", func(t *testing.T) {
-			t.Run("unix", func(t *testing.T) {
-				in := replUnix.Replace(tt.in)
-				want := replUnix.Replace(tt.want)
+		t.Run(tt.in, func(t *testing.T) {
+			validated = nil
+			var c config
+			_, err := Decode(tt.in, &c)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != tt.wantErr {
+				t.Errorf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(validated, tt.validated) {
+				t.Errorf("wrong order\nhave: %q\nwant: %q", validated, tt.validated)
+			}
+		})
+	}
 
-				var s struct{ X string }
-				_, err := Decode(in, &s)
-				if err != nil {
-					t.Fatal(err)
-				}
-				if s.X != want {
-					t.Errorf("\nhave: %q\nwant: %q", s.X, want)
-				}
-			})
+	// Also for tables that aren't in the document but get defaults.
+	var c struct {
+		Server struct {
+			Cache cache `toml:"cache"`
+		} `toml:"server"`
+	}
+	for _, in := range []string{"", "[server]", "[server.cache]"} {
+		_, err := Decode(in, &c)
+		want := "toml: key 'server.cache': min (10) is larger than max (5)"
+		if in == "[server.cache]" {
+			want = "toml: line 1, column 2: key 'server.cache': min (10) is larger than max (5)"
+		}
+		if err == nil || err.Error() != want {
+			t.Errorf("%q\nhave: %v\nwant: %s", in, err, want)
+		}
+	}
+}
 
-			t.Run("windows", func(t *testing.T) {
-				in := replWin.Replace(tt.in)
-				want := replWin.Replace(tt.want)
+type cache struct {
+	Min int `toml:"min,default=10"`
+	Max int `toml:"max,default=5"`
+}
 
-				var s struct{ X string }
-				_, err := Decode(in, &s)
+func (c cache) ValidateTOML(md MetaData) error {
+	if c.Min > c.Max {
+		return fmt.Errorf("min (%d) is larger than max (%d)", c.Min, c.Max)
+	}
+	return nil
+}
+
+func TestDecodeValidationTags(t *testing.T) {
+	type server struct {
+		Port  int      `toml:"port,min=1,max=65535"`
+		Level string   `toml:"level,oneof=debug|info|warn"`
+		Name  string   `toml:"name,pattern=^[a-z]+(,[a-z]+)?$,omitempty"`
+		Ratio float64  `toml:"ratio,min=0,max=1"`
+		Tags  []string `toml:"tags,max=2"`
+		Code  string   `toml:"code,len=3"`
+		Size  *uint    `toml:"size,max=10"`
+	}
+	type config struct {
+		Servers []server `toml:"servers"`
+	}
+	tests := []struct {
+		in      string
+		wantErr string
+		kind    error
+	}{
+		{"[[servers]]\nport = 80\nlevel = 'info'\nname = 'a,b'\nratio = 0.5\ntags = ['a', 'b']\ncode = 'ÄBC'\nsize = 10", "", nil},
+		{"[[servers]]\nport = 80\n[[servers]]\nport = 70000",
+			"toml: line 4, column 8: key 'servers[1].port': value 70000 is more than the maximum of 65535", ErrValidation},
+		{"[[servers]]\nport = 0",
+			"toml: line 2, column 8: key 'servers[0].port': value 0 is less than the minimum of 1", ErrValidation},
+		{"[[servers]]\nlevel = 'trace'",
+			`toml: line 2, column 10: key 'servers[0].level': value "trace" is not one of debug, info, warn`, ErrValidation},
+		{"[[servers]]\nname = 'A'",
+			`toml: line 2, column 9: key 'servers[0].name': value "A" doesn't match the pattern "^[a-z]+(,[a-z]+)?$"`, ErrValidation},
+		{"[[servers]]\nratio = 1.5",
+			"toml: line 2, column 9: key 'servers[0].ratio': value 1.5 is more than the maximum of 1", ErrValidation},
+		{"[[servers]]\ntags = ['a', 'b', 'c']",
+			"toml: line 2, column 8: key 'servers[0].tags': length 3 is more than the maximum of 2", ErrValidation},
+		{"[[servers]]\ncode = 'ab'",
+			"toml: line 2, column 9: key 'servers[0].code': length 2 is not 3", ErrValidation},
+		{"[[servers]]\nsize = 11",
+			"toml: line 2, column 8: key 'servers[0].size': value 11 is more than the maximum of 10", ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var c config
+			_, err := Decode(tt.in, &c)
+			if tt.wantErr == "" {
 				if err != nil {
 					t.Fatal(err)
 				}
-				if s.X != want {
-					t.Errorf("\nhave: %q\nwant: %q", s.X, want)
-				}
-			})
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("error is not %v: %v", tt.kind, err)
+			}
 		})
 	}
-}
 
-// Test for https://github.com/BurntSushi/toml/pull/166.
-func TestDecodeBoolArray(t *testing.T) {
-	for _, tt := range []struct {
-		s    string
-		got  interface{}
-		want interface{}
-	}{
-		{
-			"a = [true, false]",
-			&struct{ A []bool }{},
-			&struct{ A []bool }{[]bool{true, false}},
-		},
-		{
-			"a = {a = true, b = false}",
-			&struct{ A map[string]bool }{},
-			&struct{ A map[string]bool }{map[string]bool{"a": true, "b": false}},
-		},
-	} {
-		if _, err := Decode(tt.s, tt.got); err != nil {
-			t.Errorf("Decode(%q): %s", tt.s, err)
-			continue
-		}
-		if !reflect.DeepEqual(tt.got, tt.want) {
-			t.Errorf("Decode(%q): got %#v; want %#v", tt.s, tt.got, tt.want)
-		}
+	// Defaults are validated too.
+	_, err := Decode("", &struct {
+		Port int `toml:"port,min=1,default=0"`
+	}{})
+	if want := "toml: key 'port': value 0 is less than the minimum of 1"; err == nil || err.Error() != want {
+		t.Errorf("default\nhave: %v\nwant: %s", err, want)
 	}
-}
 
-func BenchmarkDecode(b *testing.B) {
-	var testSimple = `
-age = 250
-andrew = "gallant"
-kait = "brady"
-now = 1987-07-05T05:45:00Z
-nowEast = 2017-06-22T16:15:21+08:00
-nowWest = 2017-06-22T02:14:36-06:00
-yesOrNo = true
-pi = 3.14
-colors = [
-	["red", "green", "blue"],
-	["cyan", "magenta", "yellow", "black"],
-]
+	_, err = Decode("port = 1", &struct {
+		Port int `toml:"port,min=one"`
+	}{})
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("invalid limit: %v", err)
+	}
+	_, err = Decode("on = true", &struct {
+		On bool `toml:"on,max=1"`
+	}{})
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("bool with max: %v", err)
+	}
+}
 
-[My.Cats]
-plato = "cat 1"
-cauchy = """ cat 2
-"""
+func TestDecodeBigNumbers(t *testing.T) {
+	in := `
+hash    = 18446744073709551615
+counter = 0xffff_ffff_ffff_ffff_ffff
+neg     = -123456789012345678901234567890
+pi      = 3.14159265358979323846264338327950288
+exp     = 1e400
+int     = 42
 `
+	var c struct {
+		Hash    uint64
+		Counter *big.Int
+		Neg     big.Int
+		Pi      *big.Float
+		Exp     big.Float
+		Int     *big.Float
+	}
+	if _, err := Decode(in, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Hash != math.MaxUint64 {
+		t.Errorf("Hash = %d", c.Hash)
+	}
+	if s := c.Counter.Text(16); s != "ffffffffffffffffffff" {
+		t.Errorf("Counter = %s", s)
+	}
+	if s := c.Neg.String(); s != "-123456789012345678901234567890" {
+		t.Errorf("Neg = %s", s)
+	}
+	if s := c.Pi.Text('g', 36); s != "3.14159265358979323846264338327950288" {
+		t.Errorf("Pi = %s", s)
+	}
+	if s := c.Exp.Text('g', -1); s != "1e+400" {
+		t.Errorf("Exp = %s", s)
+	}
+	if s := c.Int.Text('g', -1); s != "42" {
+		t.Errorf("Int = %s", s)
+	}
 
-	type cats struct {
-		Plato  string
-		Cauchy string
+	var h struct{ N *big.Int }
+	dec := NewDecoder(strings.NewReader("n = 18446744073709551616"))
+	dec.Hook(func(key Key, data interface{}, typ reflect.Type) (interface{}, error) {
+		return data, nil
+	})
+	if _, err := dec.Decode(&h); err != nil {
+		t.Fatal(err)
 	}
-	type simple struct {
-		Age     int
-		Colors  [][]string
-		Pi      float64
-		YesOrNo bool
-		Now     time.Time
-		NowEast time.Time
-		NowWest time.Time
-		Andrew  string
-		Kait    string
-		My      map[string]cats
+	if s := h.N.String(); s != "18446744073709551616" {
+		t.Errorf("N = %s", s)
 	}
 
-	var val simple
-	_, err := Decode(testSimple, &val)
-	if err != nil {
-		b.Fatal(err)
+	tests := []struct {
+		in      string
+		v       interface{}
+		wantErr string
+	}{
+		{"n = 18446744073709551616", &struct{ N uint64 }{},
+			"key 'n': value 18446744073709551616 is out of range for uint64"},
+		{"n = -1", &struct{ N uint64 }{}, "key 'n': value -1 is out of range for uint64"},
+		{"n = -1", &struct{ N uint }{}, "key 'n': value -1 is out of range for uint"},
+		{"n = -0", &struct{ N uint }{}, ""},
+		{"n = 9223372036854775808", &struct{ N int64 }{},
+			"key 'n': value 9223372036854775808 is out of range for int64"},
+		{"n = 1.5", &struct{ N *big.Int }{},
+			"key 'n': cannot load TOML value of type float64 into a Go big.Int"},
+		{"n = nan", &struct{ N *big.Float }{}, "key 'n': value nan is out of range for big.Float"},
+		{"n = '123'", &struct{ N *big.Int }{}, ""}, // UnmarshalText
+		{"n = 'x'", &struct{ N *big.Int }{}, `key 'n': math/big: cannot unmarshal "x" into a *big.Int`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := Decode(tt.in, tt.v)
+			if !errorContains(err, tt.wantErr) {
+				t.Errorf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+		})
 	}
+}
 
-	b.ResetTimer()
-	for n := 0; n < b.N; n++ {
-		Decode(testSimple, &val)
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		n        Number
+		i        int64
+		f        float64
+		iErr     error
+		fErr     error
+		wantText string
+	}{
+		{n: "42", i: 42, f: 42},
+		{n: "-0x2A", i: -42, f: -42},
+		{n: "0xDEAD_BEEF", i: 0xDEADBEEF, f: 0xDEADBEEF},
+		{n: "0b101", i: 5, f: 5},
+		{n: "1_000.5", f: 1000.5, iErr: ErrTypeMismatch},
+		{n: "1e3", f: 1000, iErr: ErrTypeMismatch},
+		{n: "+inf", f: math.Inf(1), iErr: ErrTypeMismatch},
+		{n: "1e400", iErr: ErrTypeMismatch, fErr: ErrOutOfRange},
+		{n: "9223372036854775808", iErr: ErrOutOfRange, fErr: ErrOutOfRange},
+		{n: "x", iErr: ErrSyntax, fErr: ErrSyntax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n.String(), func(t *testing.T) {
+			i, err := tt.n.Int64()
+			if !errors.Is(err, tt.iErr) || (err == nil) != (tt.iErr == nil) {
+				t.Errorf("Int64 error: %v", err)
+			}
+			if i != tt.i {
+				t.Errorf("Int64 = %d; want %d", i, tt.i)
+			}
+			f, err := tt.n.Float64()
+			if !errors.Is(err, tt.fErr) || (err == nil) != (tt.fErr == nil) {
+				t.Errorf("Float64 error: %v", err)
+			}
+			if f != tt.f {
+				t.Errorf("Float64 = %f; want %f", f, tt.f)
+			}
+		})
 	}
 }
 
-func TestParseError(t *testing.T) {
-	file :=
-		`a = "a"
-b = "b"
-c = 001  # invalid
-`
+type ipv4 [4]byte
 
-	var s struct {
-		A, B string
-		C    int
+func (ip ipv4) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d.%d.%d", ip[0], ip[1], ip[2], ip[3])), nil
+}
+
+func (ip *ipv4) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d.%d.%d.%d", &ip[0], &ip[1], &ip[2], &ip[3])
+	return err
+}
+
+func TestDecodeMapKeys(t *testing.T) {
+	tests := []struct {
+		in      string
+		v       interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"1 = 'a'\n-2 = 'b'", &map[int]string{}, &map[int]string{1: "a", -2: "b"}, ""},
+		{"127 = 1", &map[int8]int{}, &map[int8]int{127: 1}, ""},
+		{"443 = 'https'", &map[uint16]string{}, &map[uint16]string{443: "https"}, ""},
+		{"[80]\nname = 'http'", &map[uint]struct{ Name string }{},
+			&map[uint]struct{ Name string }{80: {Name: "http"}}, ""},
+		{"'10.0.0.1' = 'allow'", &map[ipv4]string{}, &map[ipv4]string{{10, 0, 0, 1}: "allow"}, ""},
+
+		{"x = 1", &map[int]int{}, nil, `key 'x': key "x" is not a valid int`},
+		{"128 = 1", &map[int8]int{}, nil, `key '128': key "128" is out of range for int8`},
+		{"-1 = 1", &map[uint]int{}, nil, `key '-1': key "-1" is not a valid uint`},
+		{"'x' = 1", &map[ipv4]int{}, nil, "key 'x': expected integer"},
 	}
-	_, err := Decode(file, &s)
-	if err == nil {
-		t.Fatal("err is nil")
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := Decode(tt.in, tt.v)
+			if !errorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %q", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(tt.v, tt.want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", tt.v, tt.want)
+			}
+		})
 	}
+}
 
-	var pErr ParseError
-	if !errors.As(err, &pErr) {
-		t.Fatalf("err is not a ParseError: %T %[1]v", err)
+var errUnmarshal = errors.New("unmarshal error")
+
+type failingUnmarshaler struct{}
+
+func (failingUnmarshaler) UnmarshalTOML(interface{}) error { return errUnmarshal }
+
+type failingTextUnmarshaler struct{}
+
+func (*failingTextUnmarshaler) UnmarshalText([]byte) error { return errUnmarshal }
+
+func TestDecodeErrorIs(t *testing.T) {
+	tests := []struct {
+		in   string
+		v    interface{}
+		want error
+	}{
+		{"a = 1\na = 2", &struct{}{}, ErrDuplicateKey},
+		{"[a]\n[a]", &struct{}{}, ErrDuplicateKey},
+		{"a = 1\n[a.b]", &struct{}{}, ErrDuplicateKey},
+		{"a = {b = 1}\na.c = 2", &struct{}{}, ErrDuplicateKey},
+		{"a = 1 2", &struct{}{}, ErrSyntax},
+		{"a = 0x_1", &struct{}{}, ErrSyntax},
+		{"a = \"\xff\"", &struct{}{}, ErrInvalidUTF8},
+		{"a\x00 = 1", &struct{}{}, ErrInvalidUTF8},
+		{"a = 9223372036854775808", &struct{ A int64 }{}, ErrOutOfRange},
+		{"a = 1e1000", &struct{ A float64 }{}, ErrOutOfRange},
+		{"a = 1e1000", &struct{ A interface{} }{}, ErrOutOfRange},
+		{"a = 'x'", &struct{ A int }{}, ErrTypeMismatch},
+		{"a = 1", &struct{ A struct{} }{}, ErrTypeMismatch},
+		{"a = [1]", &struct{ A [2]int }{}, ErrTypeMismatch},
+		{"a = 256", &struct{ A uint8 }{}, ErrOutOfRange},
+		{"a = 1", &struct{ A chan int }{}, ErrUnsupportedType},
+		{"a = 1", &struct{ A map[float64]int }{}, ErrUnsupportedType},
+		{"a = {x = 1}", &struct{ A map[int]int }{}, ErrTypeMismatch},
+		{"a = {300 = 1}", &struct{ A map[uint8]int }{}, ErrOutOfRange},
+		{"a = 1", &struct{ A failingUnmarshaler }{}, errUnmarshal},
+		{"a = 'x'", &struct{ A failingTextUnmarshaler }{}, errUnmarshal},
 	}
 
-	want := ParseError{
-		Line:    3,
-		LastKey: "c",
-		Message: `Invalid integer "001": cannot have leading zeroes`,
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := Decode(tt.in, tt.v)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("errors.Is(%v, %v) is false", err, tt.want)
+			}
+		})
 	}
-	if !strings.Contains(pErr.Message, want.Message) ||
-		pErr.Line != want.Line ||
-		pErr.LastKey != want.LastKey {
-		t.Errorf("unexpected data\nhave: %#v\nwant: %#v", pErr, want)
+
+	var dErr DecodeError
+	_, err := Decode("a = 1", &struct{ A failingUnmarshaler }{})
+	if !errors.As(err, &dErr) || dErr.Key.String() != "a" || errors.Unwrap(err) != errUnmarshal {
+		t.Errorf("wrong error: %#v", err)
 	}
 }
 
@@ -4,7 +4,8 @@ files via reflection. There is also support for delaying decoding with
 the Primitive type, and querying the set of keys in a TOML document with the
 MetaData type.
 
-The specification implemented: https://github.com/toml-lang/toml
+The specification implemented: https://toml.io/en/v1.0.0; the Decoder can
+also be set to accept TOML 0.4 or the draft of TOML 1.1 with SpecVersion.
 
 The sub-command github.com/BurntSushi/toml/cmd/tomlv can be used to verify
 whether a file is a valid TOML document. It can also be used to print the
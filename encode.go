@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"reflect"
 	"sort"
 	"strconv"
@@ -16,22 +17,20 @@ import (
 
 type tomlEncodeError struct{ error }
 
+// These all match ErrUnsupportedType with errors.Is.
 var (
-	errArrayMixedElementTypes = errors.New(
-		"toml: cannot encode array with mixed element types")
-	errArrayNilElement = errors.New(
-		"toml: cannot encode array with nil element")
-	errNonString = errors.New(
-		"toml: cannot encode a map with non-string key type")
-	errAnonNonStruct = errors.New(
-		"toml: cannot encode an anonymous field that is not a struct")
-	errArrayNoTable = errors.New(
-		"toml: TOML array element cannot contain a table")
-	errNoKey = errors.New(
-		"toml: top-level values must be Go maps or structs")
-	errAnything = errors.New("") // used in testing
+	errArrayNilElement error = kindError{ErrUnsupportedType,
+		"toml: cannot encode array with nil element"}
+	errNonString error = kindError{ErrUnsupportedType,
+		"toml: cannot encode a map with key type that isn't a string, integer, or TextMarshaler"}
+	errAnonNonStruct error = kindError{ErrUnsupportedType,
+		"toml: cannot encode an anonymous field that is not a struct"}
+	errNoKey error = kindError{ErrUnsupportedType,
+		"toml: top-level values must be Go maps or structs"}
 )
 
+var errAnything = errors.New("") // used in testing
+
 var quotedReplacer = strings.NewReplacer(
 	"\"", "\\\"",
 	"\\", "\\\\",
@@ -81,6 +80,11 @@ type Encoder struct {
 	// hasWritten is whether we have written any output to w yet.
 	hasWritten bool
 	w          *bufio.Writer
+
+	// The TOML key and Go path of the value that's being encoded; only used
+	// for errors.
+	key  Key
+	path []string
 }
 
 // NewEncoder returns a TOML encoder that encodes Go values to the io.Writer
@@ -100,21 +104,27 @@ func NewEncoder(w io.Writer) *Encoder {
 // as for the Decode* functions. Similarly, the TextMarshaler interface is
 // supported by encoding the resulting bytes as strings. (If you want to write
 // arbitrary binary data then you will need to use something like base64 since
-// TOML does not have any binary types.)
+// TOML does not have any binary types.) A TextMarshaler with a pointer
+// receiver is only used if the value is addressable, for example if a pointer
+// to the struct is encoded; otherwise the value is encoded as usual.
 //
 // When encoding TOML hashes (i.e., Go maps or structs), keys without any
 // sub-hashes are encoded first.
 //
 // If a Go map is encoded, then its keys are sorted alphabetically for
-// deterministic output. More control over this behavior may be provided if
-// there is demand for it.
+// deterministic output; integer keys are sorted by their value. More control
+// over this behavior may be provided if there is demand for it. Map keys can
+// be strings, integers, or types that implement encoding.TextMarshaler.
+//
+// Tables that can't be written with a [table] or [[table]] header are written
+// as inline tables; for example arrays/slices with elements of different types
+// or nested slices containing maps or structs (e.g., [][]map[string]string is
+// written as `key = [[{a = "b"}], [{c = "d"}]]`).
 //
 // Encoding Go values without a corresponding TOML representation---like map
 // types with non-string keys---will cause an error to be returned. Similarly
-// for mixed arrays/slices, arrays/slices with nil elements, embedded
-// non-struct types and nested slices containing maps or structs.
-// (e.g., [][]map[string]string is not allowed but []map[string]string is OK
-// and so is []map[string][]string.)
+// for arrays/slices with nil elements and embedded non-struct types. The error
+// is an EncodeError with the key and Go path of the value.
 //
 // Beware: due to the use of reflection, only exported keys are encoded. Non
 // exported keys are silently discarded.
@@ -127,10 +137,16 @@ func (enc *Encoder) Encode(v interface{}) error {
 }
 
 func (enc *Encoder) safeEncode(key Key, rv reflect.Value) (err error) {
+	enc.key, enc.path = key, nil
 	defer func() {
 		if r := recover(); r != nil {
 			if terr, ok := r.(tomlEncodeError); ok {
-				err = terr.error
+				err = EncodeError{
+					Message: strings.TrimPrefix(terr.Error(), "toml: "),
+					Key:     append(Key{}, enc.key...),
+					Path:    strings.TrimPrefix(strings.Join(enc.path, ""), "."),
+					err:     terr.error,
+				}
 				return
 			}
 			panic(r)
@@ -140,13 +156,24 @@ func (enc *Encoder) safeEncode(key Key, rv reflect.Value) (err error) {
 	return nil
 }
 
+// at records that the value at the key and Go path element (".Field", "[1]",
+// or `["key"]`) is being encoded, for errors. The returned function restores
+// the previous key and path.
+func (enc *Encoder) at(key Key, elem string) (restore func()) {
+	prev := enc.key
+	enc.key, enc.path = key, append(enc.path, elem)
+	return func() {
+		enc.key, enc.path = prev, enc.path[:len(enc.path)-1]
+	}
+}
+
 func (enc *Encoder) encode(key Key, rv reflect.Value) {
 	// Special case. Time needs to be in ISO8601 format.
 	// Special case. If we can marshal the type to text, then we used that.
 	// Basically, this prevents the encoder for handling these types as
 	// generic structs (or whatever the underlying type of a TextMarshaler is).
 	switch t := rv.Interface().(type) {
-	case time.Time, encoding.TextMarshaler:
+	case time.Time, big.Int, big.Float:
 		enc.keyEqElement(key, rv)
 		return
 	// TODO: #76 would make this superfluous after implemented.
@@ -154,6 +181,10 @@ func (enc *Encoder) encode(key Key, rv reflect.Value) {
 		enc.encode(key, reflect.ValueOf(t.undecoded))
 		return
 	}
+	if _, ok := textMarshaler(rv); ok {
+		enc.keyEqElement(key, rv)
+		return
+	}
 
 	k := rv.Kind()
 	switch k {
@@ -187,7 +218,7 @@ func (enc *Encoder) encode(key Key, rv reflect.Value) {
 	case reflect.Struct:
 		enc.eTable(key, rv)
 	default:
-		encPanic(fmt.Errorf("unsupported type for key '%s': %s", key, k))
+		encPanic(fmt.Errorf("%w: %s", ErrUnsupportedType, k))
 	}
 }
 
@@ -199,8 +230,35 @@ func (enc *Encoder) eElement(rv reflect.Value) {
 		// Using TextMarshaler adds extra quotes, which we don't want.
 		enc.wf(v.Format(time.RFC3339Nano))
 		return
-	case encoding.TextMarshaler:
-		// Special case. Use text marshaler if it's available for this value.
+	case LocalDatetime, LocalDate, LocalTime:
+		// Written without quotes and without an offset.
+		enc.wf("%s", v)
+		return
+	case big.Int:
+		enc.wf("%s", v.String())
+		return
+	case *big.Int:
+		enc.wf("%s", v.String())
+		return
+	case big.Float:
+		enc.wf("%s", bigFloatText(&v))
+		return
+	case *big.Float:
+		enc.wf("%s", bigFloatText(v))
+		return
+	case Number:
+		// Written as-is; the zero value is written as 0.
+		if v == "" {
+			v = "0"
+		}
+		if !v.valid() {
+			encPanic(fmt.Errorf("%w: invalid number %q", ErrUnsupportedType, v))
+		}
+		enc.wf("%s", v)
+		return
+	}
+	// Special case. Use text marshaler if it's available for this value.
+	if v, ok := textMarshaler(rv); ok {
 		if s, err := v.MarshalText(); err != nil {
 			encPanic(err)
 		} else {
@@ -241,8 +299,12 @@ func (enc *Encoder) eElement(rv reflect.Value) {
 		enc.eElement(rv.Elem())
 	case reflect.String:
 		enc.writeQuoted(rv.String())
+	case reflect.Map:
+		enc.eMap(nil, rv, true)
+	case reflect.Struct:
+		enc.eStruct(nil, rv, true)
 	default:
-		encPanic(fmt.Errorf("unexpected primitive type: %s", rv.Kind()))
+		encPanic(fmt.Errorf("%w: unexpected primitive type: %s", ErrUnsupportedType, rv.Kind()))
 	}
 }
 
@@ -255,6 +317,21 @@ func floatAddDecimal(fstr string) string {
 	return fstr
 }
 
+// bigFloatText formats f as a TOML float, with all the digits.
+func bigFloatText(f *big.Float) string {
+	if f.IsInf() {
+		if f.Signbit() {
+			return "-inf"
+		}
+		return "+inf"
+	}
+	s := f.Text('g', -1)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
 func (enc *Encoder) writeQuoted(s string) {
 	enc.wf("\"%s\"", quotedReplacer.Replace(s))
 }
@@ -263,11 +340,13 @@ func (enc *Encoder) eArrayOrSliceElement(rv reflect.Value) {
 	length := rv.Len()
 	enc.wf("[")
 	for i := 0; i < length; i++ {
+		restore := enc.at(enc.key, fmt.Sprintf("[%d]", i))
 		elem := rv.Index(i)
 		enc.eElement(elem)
 		if i != length-1 {
 			enc.wf(", ")
 		}
+		restore()
 	}
 	enc.wf("]")
 }
@@ -281,10 +360,12 @@ func (enc *Encoder) eArrayOfTables(key Key, rv reflect.Value) {
 		if isNil(trv) {
 			continue
 		}
+		restore := enc.at(key, fmt.Sprintf("[%d]", i))
 		enc.newline()
 		enc.wf("%s[[%s]]", enc.indentStr(key), key.maybeQuotedAll())
 		enc.newline()
 		enc.eMapOrStruct(key, trv)
+		restore()
 	}
 }
 
@@ -304,49 +385,115 @@ func (enc *Encoder) eTable(key Key, rv reflect.Value) {
 func (enc *Encoder) eMapOrStruct(key Key, rv reflect.Value) {
 	switch rv := eindirect(rv); rv.Kind() {
 	case reflect.Map:
-		enc.eMap(key, rv)
+		enc.eMap(key, rv, false)
 	case reflect.Struct:
-		enc.eStruct(key, rv)
+		enc.eStruct(key, rv, false)
 	default:
 		// Should never happen?
 		panic("eTable: unhandled reflect.Value Kind: " + rv.Kind().String())
 	}
 }
 
-func (enc *Encoder) eMap(key Key, rv reflect.Value) {
-	rt := rv.Type()
-	if rt.Key().Kind() != reflect.String {
-		encPanic(errNonString)
-	}
-
+// eMap writes the keys of a map; if inline is true then it's written as an
+// inline table ({a = 1, b = 2}).
+func (enc *Encoder) eMap(key Key, rv reflect.Value, inline bool) {
 	// Sort keys so that we have deterministic output. And write keys directly
 	// underneath this key first, before writing sub-structs or sub-maps.
-	var mapKeysDirect, mapKeysSub []string
-	for _, mapKey := range rv.MapKeys() {
-		k := mapKey.String()
-		if typeIsHash(tomlTypeOfGo(rv.MapIndex(mapKey))) {
-			mapKeysSub = append(mapKeysSub, k)
+	var mapKeysDirect, mapKeysSub []mapKey
+	for _, k := range rv.MapKeys() {
+		mk := mapKey{name: mapKeyName(k), rv: k}
+		restore := enc.at(enc.key.add(mk.name), fmt.Sprintf("[%q]", mk.name))
+		if typeIsHash(tomlTypeOfGo(rv.MapIndex(k))) {
+			mapKeysSub = append(mapKeysSub, mk)
 		} else {
-			mapKeysDirect = append(mapKeysDirect, k)
+			mapKeysDirect = append(mapKeysDirect, mk)
 		}
+		restore()
 	}
 
-	var writeMapKeys = func(mapKeys []string) {
-		sort.Strings(mapKeys)
-		for _, mapKey := range mapKeys {
-			mrv := rv.MapIndex(reflect.ValueOf(mapKey))
+	n := 0 // Number of inline keys written.
+	var writeMapKeys = func(mapKeys []mapKey) {
+		sortMapKeys(mapKeys)
+		for _, mk := range mapKeys {
+			mrv := rv.MapIndex(mk.rv)
 			if isNil(mrv) {
 				// Don't write anything for nil fields.
 				continue
 			}
-			enc.encode(key.add(mapKey), mrv)
+			restore := enc.at(enc.key.add(mk.name), fmt.Sprintf("[%q]", mk.name))
+			if inline {
+				if n > 0 {
+					enc.wf(", ")
+				}
+				enc.inlineKeyEqElement(mk.name, mrv)
+				n++
+			} else {
+				enc.encode(key.add(mk.name), mrv)
+			}
+			restore()
 		}
 	}
+
+	if inline {
+		enc.wf("{")
+	}
 	writeMapKeys(mapKeysDirect)
 	writeMapKeys(mapKeysSub)
+	if inline {
+		enc.wf("}")
+	}
+}
+
+// mapKey is a key of a Go map, and the TOML key it's written as.
+type mapKey struct {
+	name string
+	rv   reflect.Value
 }
 
-func (enc *Encoder) eStruct(key Key, rv reflect.Value) {
+// mapKeyName gets the TOML key for a Go map key: the text from MarshalText if
+// the type implements encoding.TextMarshaler, or else the string or integer
+// formatted in base 10.
+func mapKeyName(k reflect.Value) string {
+	if v, ok := k.Interface().(encoding.TextMarshaler); ok {
+		text, err := v.MarshalText()
+		if err != nil {
+			encPanic(err)
+		}
+		return string(text)
+	}
+	switch k.Kind() {
+	case reflect.String:
+		return k.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	encPanic(errNonString)
+	panic("") // Need *some* return value
+}
+
+// sortMapKeys sorts the keys by name, except that integers are sorted by
+// their value.
+func sortMapKeys(keys []mapKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		switch keys[i].rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if _, ok := keys[i].rv.Interface().(encoding.TextMarshaler); !ok {
+				return keys[i].rv.Int() < keys[j].rv.Int()
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if _, ok := keys[i].rv.Interface().(encoding.TextMarshaler); !ok {
+				return keys[i].rv.Uint() < keys[j].rv.Uint()
+			}
+		}
+		return keys[i].name < keys[j].name
+	})
+}
+
+// eStruct writes the fields of a struct; if inline is true then it's written
+// as an inline table ({a = 1, b = 2}).
+func (enc *Encoder) eStruct(key Key, rv reflect.Value, inline bool) {
 	// Write keys for fields directly under this key first, because if we write
 	// a field that creates a new table, then all keys under it will be in that
 	// table (not the one we're writing here).
@@ -368,13 +515,13 @@ func (enc *Encoder) eStruct(key Key, rv reflect.Value) {
 					// Treat anonymous struct fields with
 					// tag names as though they are not
 					// anonymous, like encoding/json does.
-					if getOptions(f.Tag).name == "" {
+					if getOptions(f.Tag.Get("toml")).name == "" {
 						addFields(t, frv, append(start, f.Index...))
 						continue
 					}
 				case reflect.Ptr:
 					if t.Elem().Kind() == reflect.Struct &&
-						getOptions(f.Tag).name == "" {
+						getOptions(f.Tag.Get("toml")).name == "" {
 						if !frv.IsNil() {
 							addFields(t.Elem(), frv.Elem(), append(start, f.Index...))
 						}
@@ -385,15 +532,18 @@ func (enc *Encoder) eStruct(key Key, rv reflect.Value) {
 				}
 			}
 
+			restore := enc.at(enc.key.add(keyName(f)), "."+f.Name)
 			if typeIsHash(tomlTypeOfGo(frv)) {
 				fieldsSub = append(fieldsSub, append(start, f.Index...))
 			} else {
 				fieldsDirect = append(fieldsDirect, append(start, f.Index...))
 			}
+			restore()
 		}
 	}
 	addFields(rt, rv, nil)
 
+	n := 0 // Number of inline keys written.
 	var writeFields = func(fields [][]int) {
 		for _, fieldIndex := range fields {
 			sft := rt.FieldByIndex(fieldIndex)
@@ -403,14 +553,10 @@ func (enc *Encoder) eStruct(key Key, rv reflect.Value) {
 				continue
 			}
 
-			opts := getOptions(sft.Tag)
+			opts := getOptions(sft.Tag.Get("toml"))
 			if opts.skip {
 				continue
 			}
-			keyName := sft.Name
-			if opts.name != "" {
-				keyName = opts.name
-			}
 			if opts.omitempty && isEmpty(sf) {
 				continue
 			}
@@ -418,11 +564,29 @@ func (enc *Encoder) eStruct(key Key, rv reflect.Value) {
 				continue
 			}
 
-			enc.encode(key.add(keyName), sf)
+			keyName := keyName(sft)
+			restore := enc.at(enc.key.add(keyName), "."+sft.Name)
+			if inline {
+				if n > 0 {
+					enc.wf(", ")
+				}
+				enc.inlineKeyEqElement(keyName, sf)
+				n++
+			} else {
+				enc.encode(key.add(keyName), sf)
+			}
+			restore()
 		}
 	}
+
+	if inline {
+		enc.wf("{")
+	}
 	writeFields(fieldsDirect)
 	writeFields(fieldsSub)
+	if inline {
+		enc.wf("}")
+	}
 }
 
 // tomlTypeName returns the TOML type name of the Go value's type. It is
@@ -454,6 +618,12 @@ func tomlTypeOfGo(rv reflect.Value) tomlType {
 	case reflect.Ptr, reflect.Interface:
 		return tomlTypeOfGo(rv.Elem())
 	case reflect.String:
+		if n, ok := rv.Interface().(Number); ok {
+			if n.isFloat() {
+				return tomlFloat
+			}
+			return tomlInteger
+		}
 		return tomlString
 	case reflect.Map:
 		return tomlHash
@@ -461,34 +631,50 @@ func tomlTypeOfGo(rv reflect.Value) tomlType {
 		switch rv.Interface().(type) {
 		case time.Time:
 			return tomlDatetime
-		case encoding.TextMarshaler:
-			return tomlString
+		case LocalDatetime:
+			return tomlLocalDatetime
+		case LocalDate:
+			return tomlLocalDate
+		case LocalTime:
+			return tomlLocalTime
+		case big.Int:
+			return tomlInteger
+		case big.Float:
+			return tomlFloat
 		default:
-			// Someone used a pointer receiver: we can make it work for pointer
-			// values.
-			if rv.CanAddr() {
-				_, ok := rv.Addr().Interface().(encoding.TextMarshaler)
-				if ok {
-					return tomlString
-				}
+			if _, ok := textMarshaler(rv); ok {
+				return tomlString
 			}
 			return tomlHash
 		}
 	default:
-		_, ok := rv.Interface().(encoding.TextMarshaler)
-		if ok {
+		if _, ok := textMarshaler(rv); ok {
 			return tomlString
 		}
-		encPanic(errors.New("unsupported type: " + rv.Kind().String()))
+		encPanic(fmt.Errorf("%w: %s", ErrUnsupportedType, rv.Kind()))
 		panic("") // Need *some* return value
 	}
 }
 
+// textMarshaler returns rv as an encoding.TextMarshaler. Someone may have used
+// a pointer receiver: we can make it work for addressable values.
+func textMarshaler(rv reflect.Value) (encoding.TextMarshaler, bool) {
+	if v, ok := rv.Interface().(encoding.TextMarshaler); ok {
+		return v, true
+	}
+	if rv.CanAddr() {
+		if v, ok := rv.Addr().Interface().(encoding.TextMarshaler); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
 // tomlArrayType returns the element type of a TOML array. The type returned
 // may be nil if it cannot be determined (e.g., a nil slice or a zero length
-// slize). This function may also panic if it finds a type that cannot be
-// expressed in TOML (such as nil elements, heterogeneous arrays or directly
-// nested arrays of tables).
+// slize) or if the elements have different types. This function may also
+// panic if it finds a type that cannot be expressed in TOML (such as nil
+// elements).
 func tomlArrayType(rv reflect.Value) tomlType {
 	if isNil(rv) || !rv.IsValid() || rv.Len() == 0 {
 		return nil
@@ -498,6 +684,7 @@ func tomlArrayType(rv reflect.Value) tomlType {
 		encPanic(errArrayNilElement)
 	}
 
+	mixed := false
 	rvlen := rv.Len()
 	for i := 1; i < rvlen; i++ {
 		elem := rv.Index(i)
@@ -505,19 +692,13 @@ func tomlArrayType(rv reflect.Value) tomlType {
 		case elemType == nil:
 			encPanic(errArrayNilElement)
 		case !typeEqual(firstType, elemType):
-			encPanic(errArrayMixedElementTypes)
+			// Mixed arrays are always written as an array value, with any
+			// tables written as inline tables.
+			mixed = true
 		}
 	}
-
-	// If we have a nested array, then we must make sure that the nested array
-	// contains ONLY primitives.
-	//
-	// This checks arbitrarily nested arrays.
-	if typeEqual(firstType, tomlArray) || typeEqual(firstType, tomlArrayHash) {
-		nest := tomlArrayType(eindirect(rv.Index(0)))
-		if typeEqual(nest, tomlHash) || typeEqual(nest, tomlArrayHash) {
-			encPanic(errArrayNoTable)
-		}
+	if mixed {
+		return nil
 	}
 	return firstType
 }
@@ -527,27 +708,89 @@ type tagOptions struct {
 	name      string
 	omitempty bool
 	omitzero  bool
+	required  bool
+	def       *string // "default=..."
+
+	// Validation options for decoding.
+	min, max *string  // "min=...", "max=..."
+	length   *string  // "len=..."
+	oneof    []string // "oneof=a|b|c"
+	pattern  string   // "pattern=..."
 }
 
-func getOptions(tag reflect.StructTag) tagOptions {
-	t := tag.Get("toml")
+// keyName gets the TOML key for a struct field.
+func keyName(f reflect.StructField) string {
+	if opts := getOptions(f.Tag.Get("toml")); opts.name != "" {
+		return opts.name
+	}
+	return f.Name
+}
+
+// getOptions parses the value of a struct tag.
+func getOptions(t string) tagOptions {
 	if t == "-" {
 		return tagOptions{skip: true}
 	}
 	var opts tagOptions
 	parts := strings.Split(t, ",")
-	opts.name = parts[0]
-	for _, s := range parts[1:] {
-		switch s {
-		case "omitempty":
-			opts.omitempty = true
-		case "omitzero":
-			opts.omitzero = true
+	opts.name, parts = parts[0], parts[1:]
+	for len(parts) > 0 {
+		s := parts[0]
+		parts = parts[1:]
+
+		i := strings.IndexByte(s, '=')
+		if i == -1 {
+			switch s {
+			case "omitempty":
+				opts.omitempty = true
+			case "omitzero":
+				opts.omitzero = true
+			case "required":
+				opts.required = true
+			}
+			continue
+		}
+
+		// Values may contain commas, e.g. for an array or a pattern; these go
+		// up to the next option.
+		for len(parts) > 0 && !isTagOption(parts[0]) {
+			s += "," + parts[0]
+			parts = parts[1:]
+		}
+		v := s[i+1:]
+		switch s[:i] {
+		case "default":
+			opts.def = &v
+		case "min":
+			opts.min = &v
+		case "max":
+			opts.max = &v
+		case "len":
+			opts.length = &v
+		case "oneof":
+			opts.oneof = strings.Split(v, "|")
+		case "pattern":
+			opts.pattern = v
 		}
 	}
 	return opts
 }
 
+// isTagOption reports if s is the start of a struct tag option.
+func isTagOption(s string) bool {
+	switch s {
+	case "omitempty", "omitzero", "required":
+		return true
+	}
+	if i := strings.IndexByte(s, '='); i > -1 {
+		switch s[:i] {
+		case "default", "min", "max", "len", "oneof", "pattern":
+			return true
+		}
+	}
+	return false
+}
+
 func isZero(rv reflect.Value) bool {
 	switch rv.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -585,6 +828,12 @@ func (enc *Encoder) keyEqElement(key Key, val reflect.Value) {
 	enc.newline()
 }
 
+// inlineKeyEqElement writes a key/value pair in an inline table.
+func (enc *Encoder) inlineKeyEqElement(key string, val reflect.Value) {
+	enc.wf("%s = ", Key{key}.maybeQuoted(0))
+	enc.eElement(val)
+}
+
 func (enc *Encoder) wf(format string, v ...interface{}) {
 	if _, err := fmt.Fprintf(enc.w, format, v...); err != nil {
 		encPanic(err)
@@ -2,10 +2,13 @@ package toml
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"net"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -110,6 +113,19 @@ func TestEncode(t *testing.T) {
 			}{1.5, 2.5},
 			wantOutput: "Float32 = 1.5\nFloat64 = 2.5\n",
 		},
+		"local datetime fields": {
+			input: struct {
+				Datetime LocalDatetime
+				Date     LocalDate
+				Time     LocalTime
+			}{
+				LocalDatetime{LocalDate{1979, 05, 27}, LocalTime{07, 32, 0, 0}},
+				LocalDate{1979, 05, 27},
+				LocalTime{07, 32, 0, 999000000},
+			},
+			wantOutput: "Datetime = 1979-05-27T07:32:00\nDate = 1979-05-27\n" +
+				"Time = 07:32:00.999\n",
+		},
 		"string field": {
 			input:      struct{ String string }{"foo"},
 			wantOutput: "String = \"foo\"\n",
@@ -204,13 +220,24 @@ ArrayOfMixedSlices = [[1, 2], ["a", "b"]]
 			input:      struct{ Empty []interface{} }{[]interface{}{}},
 			wantOutput: "Empty = []\n",
 		},
-		"(error) slice with element type mismatch (string and integer)": {
-			input:     struct{ Mixed []interface{} }{[]interface{}{1, "a"}},
-			wantError: errArrayMixedElementTypes,
+		"slice with element type mismatch (string and integer)": {
+			input:      struct{ Mixed []interface{} }{[]interface{}{1, "a"}},
+			wantOutput: "Mixed = [1, \"a\"]\n",
 		},
-		"(error) slice with element type mismatch (integer and float)": {
-			input:     struct{ Mixed []interface{} }{[]interface{}{1, 2.5}},
-			wantError: errArrayMixedElementTypes,
+		"slice with element type mismatch (integer and float)": {
+			input:      struct{ Mixed []interface{} }{[]interface{}{1, 2.5}},
+			wantOutput: "Mixed = [1, 2.5]\n",
+		},
+		"slice with element type mismatch (tables and integer)": {
+			input: struct{ Mixed []interface{} }{[]interface{}{
+				map[string]interface{}{"x": 3, "y": map[string]int{"z": 4}},
+				1,
+				struct {
+					A string
+					B []int
+				}{"a", []int{1}},
+			}},
+			wantOutput: "Mixed = [{x = 3, y = {z = 4}}, 1, {A = \"a\", B = [1]}]\n",
 		},
 		"slice with elems of differing Go types, same TOML types": {
 			input: struct {
@@ -226,11 +253,11 @@ ArrayOfMixedSlices = [[1, 2], ["a", "b"]]
 			wantOutput: "MixedInts = [1, 2, 3, 4, 5, 1, 2, 3, 4, 5]\n" +
 				"MixedFloats = [1.5, 2.5]\n",
 		},
-		"(error) slice w/ element type mismatch (one is nested array)": {
+		"slice w/ element type mismatch (one is nested array)": {
 			input: struct{ Mixed []interface{} }{
 				[]interface{}{1, []interface{}{2}},
 			},
-			wantError: errArrayMixedElementTypes,
+			wantOutput: "Mixed = [1, [2]]\n",
 		},
 		"(error) slice with 1 nil element": {
 			input:     struct{ NilElement1 []interface{} }{[]interface{}{nil}},
@@ -386,16 +413,41 @@ ArrayOfMixedSlices = [[1, 2], ["a", "b"]]
 			input:     []struct{ Int int }{{1}, {2}, {3}},
 			wantError: errNoKey,
 		},
-		"(error) slice of slice": {
+		"slice of slice": {
 			input: struct {
 				Slices [][]struct{ Int int }
 			}{
 				[][]struct{ Int int }{{{1}}, {{2}}, {{3}}},
 			},
-			wantError: errArrayNoTable,
+			wantOutput: "Slices = [[{Int = 1}], [{Int = 2}], [{Int = 3}]]\n",
+		},
+		"slice of slice of maps": {
+			input: map[string]interface{}{
+				"a": [][]map[string]string{{{"a": "1"}, {"b": "2"}}, {{"c": "3"}}},
+			},
+			wantOutput: "a = [[{a = \"1\"}, {b = \"2\"}], [{c = \"3\"}]]\n",
+		},
+		"slice of tables in inline table": {
+			input: map[string]interface{}{
+				"a": []interface{}{
+					1,
+					map[string]interface{}{
+						"tbl": []map[string]int{{"x": 1}, {"y": 2}},
+					},
+				},
+			},
+			wantOutput: "a = [1, {tbl = [{x = 1}, {y = 2}]}]\n",
+		},
+		"map with int keys": {
+			input:      map[int]string{10: "b", 2: "a", -1: "c"},
+			wantOutput: "-1 = \"c\"\n2 = \"a\"\n10 = \"b\"\n",
+		},
+		"map with uint keys": {
+			input:      map[string]map[uint16]int{"a": {443: 2, 80: 1}},
+			wantOutput: "[a]\n  80 = 1\n  443 = 2\n",
 		},
 		"(error) map no string key": {
-			input:     map[int]string{1: ""},
+			input:     map[float64]string{1: ""},
 			wantError: errNonString,
 		},
 	}
@@ -444,6 +496,38 @@ func TestEncodeNestedTableArrays(t *testing.T) {
 	encodeExpected(t, "nested table arrays", value, expected, nil)
 }
 
+func TestEncodeNestedInlineTables(t *testing.T) {
+	// Anything the decoder produces can be encoded again.
+	in := `
+tbl_tbl_empty = { tbl_0 = {} }
+arr_tbl_tbl = [ { tbl = { one = 1 } } ]
+arr_arr_tbl_empty = [ [ {} ] ]
+arr_arr_tbls = [ [ { one = 1 }, { two = 2 } ] ]
+arr_mixed = [ 1, { one = [ { x = "y" } ] }, [ { two = 2 } ] ]
+`
+	var first map[string]interface{}
+	if _, err := Decode(in, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(first); err != nil {
+		t.Fatal(err)
+	}
+
+	var second map[string]interface{}
+	if _, err := Decode(buf.String(), &second); err != nil {
+		t.Fatalf("decoding encoded output: %s\n%s", err, buf.String())
+	}
+	var buf2 bytes.Buffer
+	if err := NewEncoder(&buf2).Encode(second); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != buf2.String() {
+		t.Errorf("\nfirst:\n%s\nsecond:\n%s", buf.String(), buf2.String())
+	}
+}
+
 func TestEncodeArrayHashWithNormalHashOrder(t *testing.T) {
 	type Alpha struct {
 		V int
@@ -659,7 +743,7 @@ func TestEncodeError(t *testing.T) {
 		in      interface{}
 		wantErr string
 	}{
-		{make(chan int), "unsupported type for key '': chan"},
+		{make(chan int), "unsupported type: chan"},
 		{struct{ C complex128 }{0}, "unsupported type: complex128"},
 		{[]complex128{0}, "unsupported type: complex128"},
 	}
@@ -673,6 +757,75 @@ func TestEncodeError(t *testing.T) {
 			if !errorContains(err, tt.wantErr) {
 				t.Errorf("wrong error\nhave: %q\nwant: %q", err, tt.wantErr)
 			}
+			if !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("error is not ErrUnsupportedType: %v", err)
+			}
+		})
+	}
+}
+
+func TestEncodeErrorKey(t *testing.T) {
+	type (
+		server struct {
+			Name string
+			Tags []interface{}
+			Meta map[string]interface{}
+		}
+		config struct {
+			Servers []server `toml:"servers"`
+			Inline  [][]server
+			Limits  map[string]map[bool]int
+			Embed   struct {
+				F complex64 `toml:"f"`
+			}
+		}
+	)
+
+	tests := []struct {
+		in      config
+		key     string
+		path    string
+		wantErr string
+	}{
+		{config{Servers: []server{{}, {Tags: []interface{}{1, nil}}}},
+			"servers.Tags", "Servers[1].Tags",
+			"toml: key 'servers.Tags' (field Servers[1].Tags): cannot encode array with nil element"},
+		{config{Servers: []server{{Meta: map[string]interface{}{"x": []interface{}{nil}}}}},
+			"servers.Meta.x", `Servers[0].Meta["x"]`,
+			"cannot encode array with nil element"},
+		{config{Inline: [][]server{{{Meta: map[string]interface{}{"c": make(chan int)}}}}},
+			"Inline.Meta.c", `Inline[0][0].Meta["c"]`,
+			"unsupported type: chan"},
+		{config{Limits: map[string]map[bool]int{"a": {true: 1}}},
+			"Limits.a", `Limits["a"]`,
+			"cannot encode a map with key type"},
+		{config{Embed: struct {
+			F complex64 `toml:"f"`
+		}{1}},
+			"Embed.f", "Embed.F",
+			"unsupported type: complex64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := NewEncoder(new(bytes.Buffer)).Encode(tt.in)
+
+			var eErr EncodeError
+			if !errors.As(err, &eErr) {
+				t.Fatalf("err is not an EncodeError: %T %[1]v", err)
+			}
+			if eErr.Key.String() != tt.key {
+				t.Errorf("wrong key\nhave: %q\nwant: %q", eErr.Key, tt.key)
+			}
+			if eErr.Path != tt.path {
+				t.Errorf("wrong path\nhave: %q\nwant: %q", eErr.Path, tt.path)
+			}
+			if !errorContains(err, tt.wantErr) {
+				t.Errorf("wrong error\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+			if !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("error is not ErrUnsupportedType: %v", err)
+			}
 		})
 	}
 }
@@ -742,6 +895,163 @@ Fun = "why would you do this?"
 	}
 }
 
+type pair struct{ A, B string }
+
+func (p *pair) MarshalText() ([]byte, error) { return []byte(p.A + "/" + p.B), nil }
+func (p *pair) UnmarshalText(text []byte) error {
+	s := strings.SplitN(string(text), "/", 2)
+	if len(s) != 2 {
+		return fmt.Errorf("invalid pair: %q", text)
+	}
+	p.A, p.B = s[0], s[1]
+	return nil
+}
+
+// Types with a pointer receiver are encoded as text if the value is
+// addressable, and decoded from both the text and the table.
+func TestEncodeTextMarshalerRoundTrip(t *testing.T) {
+	type config struct {
+		Pair  pair
+		Num   int
+		Pairs []pair
+	}
+	in := config{Pair: pair{"a", "b"}, Num: 1, Pairs: []pair{{"c", "d"}}}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	want := "Pair = \"a/b\"\nNum = 1\nPairs = [\"c/d\"]\n"
+	if buf.String() != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	var out config
+	if _, err := Decode(buf.String(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("\nhave: %#v\nwant: %#v", out, in)
+	}
+
+	// Not addressable, so it's written as a table.
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	out = config{}
+	if _, err := Decode(buf.String(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("\nhave: %#v\nwant: %#v", out, in)
+	}
+}
+
+func TestEncodeMapKeysRoundTrip(t *testing.T) {
+	in := map[string]interface{}{
+		"ports": map[uint16]string{443: "https", 80: "http"},
+		"ips":   map[ipv4]int{{10, 0, 0, 2}: 2, {10, 0, 0, 1}: 1},
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	want := "[ips]\n  \"10.0.0.1\" = 1\n  \"10.0.0.2\" = 2\n\n[ports]\n  80 = \"http\"\n  443 = \"https\"\n"
+	if buf.String() != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	var out struct {
+		Ports map[uint16]string
+		IPs   map[ipv4]int
+	}
+	if _, err := Decode(buf.String(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Ports, in["ports"]) || !reflect.DeepEqual(out.IPs, in["ips"]) {
+		t.Errorf("\nhave: %#v\nwant: %#v", out, in)
+	}
+}
+
+func TestEncodeBigNumbers(t *testing.T) {
+	n, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	f, _, _ := big.ParseFloat("3.14159265358979323846264338327950288", 10, 128, big.ToNearestEven)
+	in := struct {
+		Hash  uint64
+		Int   *big.Int
+		IntV  big.Int
+		Float *big.Float
+		Whole *big.Float
+		Inf   *big.Float
+		Ints  []*big.Int
+	}{
+		Hash:  math.MaxUint64,
+		Int:   n,
+		IntV:  *big.NewInt(42),
+		Float: f,
+		Whole: big.NewFloat(3),
+		Inf:   new(big.Float).SetInf(true),
+		Ints:  []*big.Int{big.NewInt(1), n},
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	want := `Hash = 18446744073709551615
+Int = -123456789012345678901234567890
+IntV = 42
+Float = 3.14159265358979323846264338327950288
+Whole = 3.0
+Inf = -inf
+Ints = [1, -123456789012345678901234567890]
+`
+	if buf.String() != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	out := in
+	out.Int, out.IntV, out.Float, out.Whole, out.Inf, out.Ints = nil, big.Int{}, nil, nil, nil, nil
+	if _, err := Decode(buf.String(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Hash != in.Hash || out.Int.Cmp(in.Int) != 0 || out.IntV.Cmp(&in.IntV) != 0 ||
+		out.Float.Text('g', -1) != in.Float.Text('g', -1) || out.Whole.Cmp(in.Whole) != 0 || !out.Inf.IsInf() ||
+		len(out.Ints) != 2 || out.Ints[1].Cmp(n) != 0 {
+		t.Errorf("\nhave: %v\nwant: %v", out, in)
+	}
+}
+
+func TestEncodeNumber(t *testing.T) {
+	in := "hex = 0xDEAD_BEEF\nbig = 1e400\npi = 3.14159265358979323846264338\nints = [1_000, 0o17]\n"
+	var c struct {
+		Hex  Number   `toml:"hex"`
+		Big  Number   `toml:"big"`
+		Pi   Number   `toml:"pi"`
+		Ints []Number `toml:"ints"`
+		Zero Number   `toml:"zero"`
+	}
+	if _, err := Decode(in, &c); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	if want := in + "zero = 0\n"; buf.String() != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, n := range []Number{"x", ".5", "5.", "Inf", "0X1F", "0755", "1_", "1 # c", "1\nm = 2", "'1'"} {
+		err := NewEncoder(&buf).Encode(map[string]Number{"n": n})
+		var eErr EncodeError
+		if !errors.As(err, &eErr) || !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%q: wrong error: %v", n, err)
+		}
+	}
+}
+
 func encodeExpected(
 	t *testing.T, label string, val interface{}, wantStr string, wantErr error,
 ) {
@@ -749,7 +1059,7 @@ func encodeExpected(
 	var buf bytes.Buffer
 	enc := NewEncoder(&buf)
 	err := enc.Encode(val)
-	if err != wantErr {
+	if !errors.Is(err, wantErr) {
 		if wantErr != nil {
 			if wantErr == errAnything && err != nil {
 				return
@@ -0,0 +1,328 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors returned by this package wrap one of these, so that they can be
+// checked with errors.Is:
+//
+//	if errors.Is(err, toml.ErrDuplicateKey) {
+//		...
+//	}
+//
+// Use errors.As with ParseError, DecodeError, or EncodeError to get the
+// details, such as the position in the document.
+var (
+	// ErrSyntax is for documents that aren't valid TOML, except for the more
+	// specific ErrDuplicateKey, ErrInvalidUTF8, and ErrOutOfRange.
+	ErrSyntax = errors.New("toml: syntax error")
+
+	// ErrDuplicateKey is for keys and tables that are defined more than once,
+	// and for several keys that match the same struct field.
+	ErrDuplicateKey = errors.New("toml: duplicate key")
+
+	// ErrInvalidUTF8 is for documents that aren't valid UTF-8.
+	ErrInvalidUTF8 = errors.New("toml: invalid UTF-8")
+
+	// ErrTypeMismatch is for TOML values that can't be decoded into the Go
+	// type, such as a string into an int.
+	ErrTypeMismatch = errors.New("toml: type mismatch")
+
+	// ErrOutOfRange is for numbers that are too large or too small for the
+	// TOML or Go type.
+	ErrOutOfRange = errors.New("toml: value out of range")
+
+	// ErrUnknownField is for keys in the document that don't correspond to a
+	// field in the Go struct.
+	ErrUnknownField = errors.New("toml: unknown field")
+
+	// ErrMissingField is for fields with the "required" option that aren't in
+	// the document.
+	ErrMissingField = errors.New("toml: missing required field")
+
+	// ErrValidation is for values that don't pass the min, max, len, oneof,
+	// or pattern options in the struct tag.
+	ErrValidation = errors.New("toml: validation failed")
+
+	// ErrUndefinedVar is for ${NAME} in a string that refers to something
+	// that's not set.
+	ErrUndefinedVar = errors.New("toml: undefined variable")
+
+	// ErrReference is for ${key} in a string that refers to a value that
+	// isn't a string, or that refers back to itself.
+	ErrReference = errors.New("toml: invalid reference")
+
+	// ErrInclude is for an include key that isn't valid, or files that
+	// include each other.
+	ErrInclude = errors.New("toml: invalid include")
+
+	// ErrLimitExceeded is for documents that go over one of the Limits set
+	// on the Decoder.
+	ErrLimitExceeded = errors.New("toml: limit exceeded")
+
+	// ErrUnsupportedType is for Go types that can't be decoded into or
+	// encoded, such as channels or maps with non-string keys.
+	ErrUnsupportedType = errors.New("toml: unsupported type")
+)
+
+// kindError is an error with its own message that matches one of the Err*
+// sentinels with errors.Is.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e kindError) Error() string { return e.msg }
+func (e kindError) Unwrap() error { return e.kind }
+
+// Position of an item or error in the TOML document.
+type Position struct {
+	Line  int // Line number, starting at 1.
+	Col   int // Column in characters, starting at 1.
+	Start int // Byte offset from the start of the document, starting at 0.
+	Len   int // Length in bytes.
+}
+
+// ParseError is used when a file can't be parsed: for example invalid integer
+// literals, duplicate keys, etc.
+//
+// The Error method only reports the position; use ErrorWithPosition to also
+// show the offending line of the document.
+type ParseError struct {
+	Message  string
+	Position Position // Exact position of the error.
+	LastKey  string   // Last key that was parsed, if any.
+	Filename string   // Name of the file, if known (e.g. with DecodeFile).
+
+	// Line is the same as Position.Line; it's kept for compatibility.
+	Line int
+
+	input string
+	err   error
+}
+
+func (pe ParseError) Error() string {
+	msg := fmt.Sprintf("line %d, column %d (last key parsed '%s'): %s",
+		pe.Position.Line, pe.Position.Col, pe.LastKey, pe.Message)
+	if pe.Filename != "" {
+		return pe.Filename + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the Err* sentinel for this error, such as ErrSyntax or
+// ErrDuplicateKey, or an error that matches it, such as ErrInclude for an
+// included file that can't be read.
+func (pe ParseError) Unwrap() error { return pe.err }
+
+// ErrorWithPosition returns the error with the offending line of the
+// document and a caret under the error, for example:
+//
+//	line 3, column 5 (last key parsed 'c'): Invalid integer "001": cannot have leading zeroes
+//
+//	      2 | b = "b"
+//	      3 | c = 001  # invalid
+//	              ^^^
+//
+// This is the same as Error if the document isn't known.
+func (pe ParseError) ErrorWithPosition() string {
+	if pe.input == "" || pe.Position.Line < 1 {
+		return pe.Error()
+	}
+
+	lines := strings.Split(pe.input, "\n")
+	if pe.Position.Line > len(lines) {
+		return pe.Error()
+	}
+
+	b := new(strings.Builder)
+	b.WriteString(pe.Error())
+	b.WriteString("\n\n")
+	if pe.Position.Line > 1 {
+		fmt.Fprintf(b, "% 7d | %s\n", pe.Position.Line-1,
+			strings.TrimRight(lines[pe.Position.Line-2], "\r"))
+	}
+	line := strings.TrimRight(lines[pe.Position.Line-1], "\r")
+	fmt.Fprintf(b, "% 7d | %s\n", pe.Position.Line, line)
+
+	// Keep tabs so that the caret lines up with the source line.
+	b.WriteString("          ")
+	col := 0
+	for _, r := range line {
+		col++
+		if col >= pe.Position.Col {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	b.WriteString(strings.Repeat("^", pe.caretLen()))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// DecodeError is returned if a TOML value can't be decoded into a Go value: for
+// example because the types don't match, or an integer is out of range.
+//
+// It wraps one of the Err* sentinels, or the error returned by an UnmarshalTOML
+// or UnmarshalText method.
+type DecodeError struct {
+	Message  string
+	Key      Key      // Full key of the value; empty for the top-level table.
+	Path     string   // Key with the index in arrays, e.g. servers[1].host.
+	Position Position // Position of the value; zero if not known.
+	Filename string   // File the value is in, if known (e.g. with DecodeFile).
+
+	err error
+}
+
+func (de DecodeError) Error() string {
+	b := new(strings.Builder)
+	b.WriteString("toml: ")
+	if de.Filename != "" {
+		b.WriteString(de.Filename + ": ")
+	}
+	if de.Position.Line > 0 {
+		fmt.Fprintf(b, "line %d, column %d: ", de.Position.Line, de.Position.Col)
+	}
+	if de.Path != "" {
+		fmt.Fprintf(b, "key '%s': ", de.Path)
+	} else if len(de.Key) > 0 {
+		fmt.Fprintf(b, "key '%s': ", de.Key)
+	}
+	b.WriteString(de.Message)
+	return b.String()
+}
+
+// Unwrap returns the wrapped error.
+func (de DecodeError) Unwrap() error { return de.err }
+
+// EncodeError is returned if a Go value can't be encoded: for example a map
+// with non-string keys, or a slice with a nil element.
+//
+// It wraps one of the Err* sentinels, or the error returned by a MarshalText
+// method or the io.Writer.
+type EncodeError struct {
+	Message string
+	Key     Key    // TOML key of the value; empty for the top-level value.
+	Path    string // Go path of the value, e.g. Servers[1].Tags or Limits["x"].
+
+	err error
+}
+
+func (ee EncodeError) Error() string {
+	var where []string
+	if len(ee.Key) > 0 {
+		where = append(where, fmt.Sprintf("key '%s'", ee.Key))
+	}
+	if ee.Path != "" {
+		where = append(where, fmt.Sprintf("(field %s)", ee.Path))
+	}
+	if len(where) == 0 {
+		return "toml: " + ee.Message
+	}
+	return "toml: " + strings.Join(where, " ") + ": " + ee.Message
+}
+
+// Unwrap returns the wrapped error.
+func (ee EncodeError) Unwrap() error { return ee.err }
+
+// DecodeErrors is a list of errors, in the order of the document; this is
+// returned if there are several errors that can all be reported at once, such
+// as missing required fields, or the unknown fields with
+// Decoder.DisallowUnknownFields.
+//
+// errors.Is reports true if it's true for any of the errors.
+type DecodeErrors []DecodeError
+
+func (de DecodeErrors) Error() string {
+	msgs := make([]string, 0, len(de))
+	for _, e := range de {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Is reports if any of the errors matches target.
+func (de DecodeErrors) Is(target error) bool {
+	for _, e := range de {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseErrors is a list of errors in a document, sorted by position; this is
+// returned instead of a ParseError if Decoder.AllErrors is set.
+//
+// errors.Is and errors.As report true if it's true for any of the errors.
+type ParseErrors []ParseError
+
+func (pe ParseErrors) Error() string {
+	switch len(pe) {
+	case 0:
+		return "no errors"
+	case 1:
+		return pe[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", pe[0].Error(), len(pe)-1)
+}
+
+// Is reports if any of the errors matches target.
+func (pe ParseErrors) Is(target error) bool {
+	for _, e := range pe {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches target, and sets target to it.
+func (pe ParseErrors) As(target interface{}) bool {
+	for _, e := range pe {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorWithPosition returns the ErrorWithPosition of all the errors,
+// separated by a blank line.
+func (pe ParseErrors) ErrorWithPosition() string {
+	msgs := make([]string, 0, len(pe))
+	for _, e := range pe {
+		msgs = append(msgs, e.ErrorWithPosition())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// caretLen gets the number of characters to underline on the error line; this
+// is at least one, and never runs past the end of the line.
+func (pe ParseError) caretLen() int {
+	start := pe.Position.Start
+	end := start + pe.Position.Len
+	if start > len(pe.input) {
+		return 1
+	}
+	if end > len(pe.input) {
+		end = len(pe.input)
+	}
+	span := pe.input[start:end]
+	if i := strings.IndexAny(span, "\r\n"); i > -1 {
+		span = span[:i]
+	}
+	if n := utf8.RuneCountInString(span); n > 0 {
+		return n
+	}
+	return 1
+}
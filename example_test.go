@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -224,6 +225,26 @@ key3 = "value3"
 	// Undecoded keys: ["key2"]
 }
 
+func ExampleDecoder_DisallowUnknownFields() {
+	var blob = `
+timout = 5
+
+[plugins.foo]
+path = "/usr/lib/foo.so"
+`
+	type config struct {
+		Timeout int
+	}
+
+	var conf config
+	dec := toml.NewDecoder(strings.NewReader(blob))
+	dec.DisallowUnknownFields("plugins.*")
+	_, err := dec.Decode(&conf)
+	fmt.Println(err)
+	// Output:
+	// toml: line 2, column 10: key 'timout': unknown field; did you mean 'Timeout'?
+}
+
 type order struct {
 	// NOTE `order.parts` is a private slice of type `part` which is an
 	// interface and may only be loaded from toml using the UnmarshalTOML()
@@ -0,0 +1,257 @@
+package toml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// template is a basic string with ${...} in it. These are expanded once the
+// whole document is parsed, as a reference can be to a key that comes later.
+type template struct {
+	s   string   // The string, with the escapes replaced.
+	key string   // Key the string is in; used for errors.
+	pos Position // Position of the string; used for errors.
+	p   *parser  // Parser of the file the string is in; used for errors.
+
+	expanding bool
+	expanded  bool
+	dropped   bool // Overridden by a value from another file.
+	val       string
+}
+
+// basicString returns the value of a basic string, which is a *template if it
+// needs to be expanded.
+func (p *parser) basicString(s string) interface{} {
+	if p.lookupEnv == nil && !p.refs || !strings.Contains(s, "${") {
+		return s
+	}
+	t := &template{s: s, key: p.current(), pos: p.pos, p: p}
+	p.templates = append(p.templates, t)
+	return t
+}
+
+// expandTemplates expands all templates in the document, and replaces them
+// with the resulting string in p.mapping.
+func (p *parser) expandTemplates() (err error) {
+	if len(p.templates) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(ParseError); ok {
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	// Expand in the order of the document, so that the first error is always
+	// the same.
+	for _, t := range p.templates {
+		if !t.dropped {
+			p.expand(t)
+		}
+	}
+	replaceTemplates(p.mapping)
+	return nil
+}
+
+func replaceTemplates(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *template:
+		return v.val
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = replaceTemplates(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = replaceTemplates(v[i])
+		}
+	case []map[string]interface{}:
+		for _, m := range v {
+			replaceTemplates(m)
+		}
+	}
+	return v
+}
+
+// expand replaces ${NAME} and ${NAME:-default} in a template; the default is
+// used if NAME is unset or empty. $${ is a literal ${.
+func (p *parser) expand(t *template) string {
+	if t.expanded {
+		return t.val
+	}
+	if t.expanding {
+		cycle := []string{t.key}
+		for i := len(p.expanding) - 1; p.expanding[i] != t; i-- {
+			cycle = append(cycle, p.expanding[i].key)
+		}
+		cycle = append(cycle, t.key)
+		for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+			cycle[i], cycle[j] = cycle[j], cycle[i]
+		}
+		p.templateErrf(t, ErrReference, "reference cycle: %s", strings.Join(cycle, " -> "))
+	}
+	t.expanding = true
+	p.expanding = append(p.expanding, t)
+
+	var (
+		b strings.Builder
+		s = t.s
+	)
+	for {
+		i := strings.Index(s, "${")
+		if i == -1 {
+			b.WriteString(s)
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end == -1 {
+			p.templateErrf(t, ErrSyntax, "unterminated ${ in string; use $${ for a literal ${")
+		}
+		name, def := s[i+2:i+end], ""
+		hasDef := false
+		if j := strings.Index(name, ":-"); j > -1 {
+			name, def, hasDef = name[:j], name[j+2:], true
+		}
+
+		v := p.lookupVar(t, name, hasDef)
+		if v == "" && hasDef {
+			v = def
+		}
+		b.WriteString(v)
+		s = s[i+end+1:]
+	}
+
+	p.expanding = p.expanding[:len(p.expanding)-1]
+	t.expanding, t.expanded, t.val = false, true, b.String()
+	return t.val
+}
+
+// lookupVar looks up the value of ${name} in a template, which is a key in the
+// document if references are enabled, or an environment variable.
+//
+// Keys take precedence, so ${HOME} is the value of the top-level key "HOME" if
+// there is one, rather than the environment variable.
+func (p *parser) lookupVar(t *template, name string, hasDef bool) string {
+	if p.refs {
+		if !isRefName(name) {
+			p.templateErrf(t, ErrSyntax, "invalid reference %q", name)
+		}
+		if v, ok := lookupKey(p.mapping, strings.Split(name, ".")); ok {
+			switch v := v.(type) {
+			case string:
+				return v
+			case *template:
+				return p.expand(v)
+			}
+			p.templateErrf(t, ErrReference, "reference to %q, which is %s rather than a string",
+				name, refType(p.types[name]))
+		}
+	}
+	if p.lookupEnv != nil {
+		if isEnvName(name) {
+			if v, ok := p.lookupEnv(name); ok {
+				return v
+			}
+		} else if !p.refs {
+			p.templateErrf(t, ErrSyntax, "invalid environment variable name %q", name)
+		}
+	}
+
+	switch {
+	case hasDef:
+		return ""
+	case !p.refs:
+		p.templateErrf(t, ErrUndefinedVar, "environment variable %q isn't set", name)
+	case p.lookupEnv == nil:
+		p.templateErrf(t, ErrUndefinedVar, "undefined reference %q", name)
+	}
+	p.templateErrf(t, ErrUndefinedVar, "%q isn't a key in the document or an environment variable", name)
+	panic("unreachable")
+}
+
+// templateErrf panics with a ParseError for the string in t.
+func (p *parser) templateErrf(t *template, err error, format string, v ...interface{}) {
+	panic(ParseError{
+		Message:  fmt.Sprintf(format, v...),
+		Position: t.pos,
+		Line:     t.pos.Line,
+		LastKey:  t.key,
+		Filename: t.p.file,
+		input:    t.p.lx.input,
+		err:      err,
+	})
+}
+
+// lookupKey gets the value of a key in a table; keys in arrays of tables can't
+// be looked up.
+func lookupKey(tbl map[string]interface{}, key []string) (interface{}, bool) {
+	v, ok := tbl[key[0]]
+	if !ok || len(key) == 1 {
+		return v, ok
+	}
+	if tbl, ok := v.(map[string]interface{}); ok {
+		return lookupKey(tbl, key[1:])
+	}
+	return nil, false
+}
+
+// refType describes the type of a value that a reference can't refer to.
+func refType(t tomlType) string {
+	if t == nil {
+		return "a value"
+	}
+	switch t.typeString() {
+	case "Hash":
+		return "a table"
+	case "ArrayHash":
+		return "an array of tables"
+	case "Array":
+		return "an array"
+	case "Integer":
+		return "an integer"
+	case "Float":
+		return "a float"
+	case "Bool":
+		return "a bool"
+	}
+	return "a datetime"
+}
+
+// isRefName reports if s is a dotted key of bare keys.
+func isRefName(s string) bool {
+	for _, k := range strings.Split(s, ".") {
+		if k == "" {
+			return false
+		}
+		for _, r := range k {
+			if !isBareKeyChar(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isEnvName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r == '-' || !isBareKeyChar(r) || i == 0 && isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
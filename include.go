@@ -0,0 +1,254 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// includeKey is the top-level key with the files to include; see
+// Decoder.Includes.
+const includeKey = "include"
+
+// parseIncludes parses the document and merges the files it includes.
+func (dec *Decoder) parseIncludes(data, fname string) (*parser, error) {
+	p, err := parseDocument(data, dec)
+	if err != nil {
+		return nil, err
+	}
+	p.file = fname
+	if err := dec.include(p, []string{fname}); err != nil {
+		return nil, err
+	}
+	return p, p.expandTemplates()
+}
+
+// include merges the files in the include key of p into p, after merging the
+// files they include. stack is the files that are being included, to detect
+// cycles.
+func (dec *Decoder) include(p *parser, stack []string) error {
+	v, ok := p.mapping[includeKey]
+	if !ok {
+		return nil
+	}
+	pos, typ := p.positions[includeKey], p.types[includeKey]
+	p.drop(Key{includeKey}, v)
+	delete(p.mapping, includeKey)
+
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	var files []string
+	for _, f := range list {
+		pattern, ok := f.(string)
+		if !ok {
+			if _, ok := f.(*template); ok {
+				return p.includeErr(pos, ErrInclude, "can't use ${ in include")
+			}
+			return p.includeErr(pos, ErrInclude, "include must be a string or an array of strings, not %s",
+				refType(typ))
+		}
+
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(p.file), pattern)
+		}
+		if !hasMeta(pattern) {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return p.includeErr(pos, includeError{err}, "invalid pattern %q: %s", f, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	merged := &parser{
+		mapping:   make(map[string]interface{}),
+		types:     make(map[string]tomlType),
+		positions: make(map[string]Position),
+		files:     make(map[string]string),
+	}
+	for _, f := range files {
+		for i, s := range stack {
+			if s != "" && sameFile(s, f) {
+				return p.includeErr(pos, ErrInclude, "include cycle: %s -> %s",
+					strings.Join(stack[i:], " -> "), f)
+			}
+		}
+
+		inc, err := dec.parseFile(f)
+		if err != nil {
+			if errors.As(err, new(ParseError)) || errors.As(err, new(ParseErrors)) {
+				return err
+			}
+			return p.includeErr(pos, includeError{err}, "can't include: %s", err)
+		}
+		if err := dec.include(inc, append(stack, f)); err != nil {
+			return err
+		}
+		merged.merge(inc)
+	}
+	merged.merge(p)
+	p.mapping, p.types, p.positions, p.ordered = merged.mapping, merged.types, merged.positions, merged.ordered
+	p.templates, p.files = merged.templates, merged.files
+	return nil
+}
+
+// parseFile reads and parses an included file.
+func (dec *Decoder) parseFile(fpath string) (*parser, error) {
+	fp, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	data, err := dec.read(fp)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parseDocument(data, dec)
+	if err != nil {
+		return nil, setFilename(err, fpath)
+	}
+	p.file = fpath
+	return p, nil
+}
+
+// merge merges the document in src into p; keys in src take precedence, except
+// for tables which are merged.
+func (p *parser) merge(src *parser) {
+	p.mergeTables(p.mapping, src.mapping, nil)
+
+	have := make(map[string]bool, len(p.ordered))
+	for _, k := range p.ordered {
+		have[k.String()] = true
+	}
+	for _, k := range src.ordered {
+		if !have[k.String()] {
+			p.ordered = append(p.ordered, k)
+		}
+	}
+	for k, pos := range src.positions {
+		p.positions[k] = pos
+	}
+	for k, t := range src.types {
+		p.types[k] = t
+		if f, ok := src.files[k]; ok {
+			p.files[k] = f
+		} else {
+			p.files[k] = src.file
+		}
+	}
+	p.templates = append(p.templates, src.templates...)
+}
+
+func (p *parser) mergeTables(dst, src map[string]interface{}, key Key) {
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok {
+			dtbl, ok1 := dv.(map[string]interface{})
+			stbl, ok2 := sv.(map[string]interface{})
+			if ok1 && ok2 {
+				p.mergeTables(dtbl, stbl, key.add(k))
+				continue
+			}
+			p.drop(key.add(k), dv)
+		}
+		dst[k] = sv
+	}
+}
+
+// drop removes the key and all keys below it from the metadata, for values
+// that are replaced by a value from another file.
+func (p *parser) drop(key Key, v interface{}) {
+	ks := key.String()
+	below := func(k string) bool {
+		return k == ks || strings.HasPrefix(k, ks+".") || strings.HasPrefix(k, ks+"[")
+	}
+	for k := range p.types {
+		if below(k) {
+			delete(p.types, k)
+			delete(p.files, k)
+		}
+	}
+	for k := range p.positions {
+		if below(k) {
+			delete(p.positions, k)
+		}
+	}
+	ordered := p.ordered[:0]
+	for _, k := range p.ordered {
+		if s := k.String(); s != ks && !strings.HasPrefix(s, ks+".") {
+			ordered = append(ordered, k)
+		}
+	}
+	p.ordered = ordered
+	dropTemplates(v)
+}
+
+// dropTemplates marks all templates in v as dropped, so they're not expanded.
+func dropTemplates(v interface{}) {
+	switch v := v.(type) {
+	case *template:
+		v.dropped = true
+	case map[string]interface{}:
+		for _, vv := range v {
+			dropTemplates(vv)
+		}
+	case []interface{}:
+		for _, vv := range v {
+			dropTemplates(vv)
+		}
+	case []map[string]interface{}:
+		for _, m := range v {
+			dropTemplates(m)
+		}
+	}
+}
+
+// includeErr returns a ParseError for the include key in p.
+func (p *parser) includeErr(pos Position, err error, format string, v ...interface{}) error {
+	return ParseError{
+		Message:  fmt.Sprintf(format, v...),
+		Position: pos,
+		Line:     pos.Line,
+		LastKey:  includeKey,
+		Filename: p.file,
+		input:    p.lx.input,
+		err:      err,
+	}
+}
+
+// includeError is an error from reading an included file; it matches both
+// ErrInclude and the error it wraps, such as os.ErrNotExist.
+type includeError struct{ err error }
+
+func (e includeError) Error() string        { return e.err.Error() }
+func (e includeError) Unwrap() error        { return e.err }
+func (e includeError) Is(target error) bool { return target == ErrInclude }
+
+// hasMeta reports if path has any of the special characters for
+// filepath.Glob; a backslash is the path separator on Windows, rather than an
+// escape.
+func hasMeta(path string) bool {
+	magic := `*?[`
+	if runtime.GOOS != "windows" {
+		magic = `*?[\`
+	}
+	return strings.ContainsAny(path, magic)
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	sa, err1 := os.Stat(a)
+	sb, err2 := os.Stat(b)
+	return err1 == nil && err2 == nil && os.SameFile(sa, sb)
+}
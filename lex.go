@@ -31,6 +31,7 @@ const (
 	itemArrayTableStart
 	itemArrayTableEnd
 	itemKeyStart
+	itemKeyEnd
 	itemCommentStart
 	itemInlineTableStart
 	itemInlineTableEnd
@@ -59,12 +60,14 @@ const (
 type stateFn func(lx *lexer) stateFn
 
 type lexer struct {
-	input string
-	start int
-	pos   int
-	line  int
-	state stateFn
-	items chan item
+	input   string
+	start   int
+	pos     int
+	line    int
+	lastPos int // start of the last rune read by next(); used for errors.
+	state   stateFn
+	items   chan item
+	version Version
 
 	// Allow for backing up up to four runes.
 	// This is necessary because TOML contains 3-rune tokens (""" and ''').
@@ -83,9 +86,10 @@ type lexer struct {
 }
 
 type item struct {
-	typ  itemType
-	val  string
-	line int
+	typ itemType
+	val string
+	pos Position
+	err error // Sentinel error for itemError.
 }
 
 func (lx *lexer) nextItem() item {
@@ -99,17 +103,77 @@ func (lx *lexer) nextItem() item {
 	}
 }
 
-func lex(input string) *lexer {
+func lex(input string, version Version) *lexer {
 	lx := &lexer{
-		input: input,
-		state: lexTop,
-		line:  1,
-		items: make(chan item, 10),
-		stack: make([]stateFn, 0, 10),
+		input:   input,
+		state:   lexTop,
+		line:    1,
+		items:   make(chan item, 10),
+		stack:   make([]stateFn, 0, 10),
+		version: version,
 	}
 	return lx
 }
 
+// resync restarts the lexer at the top level, at the start of the first line
+// after the last rune that was read which looks like a [table] header or a
+// key/value pair; everything before that is skipped. This is used to continue
+// after an error.
+func (lx *lexer) resync() {
+	pos := len(lx.input)
+	for i := lx.lastPos; i < len(lx.input); {
+		nl := strings.IndexByte(lx.input[i:], '\n')
+		if nl == -1 {
+			break
+		}
+		i += nl + 1
+
+		line := lx.input[i:]
+		if end := strings.IndexByte(line, '\n'); end > -1 {
+			line = line[:end]
+		}
+		if isTopLevelLine(line) {
+			pos = i
+			break
+		}
+	}
+
+	line := lx.getPos(pos, pos).Line
+	*lx = *lex(lx.input, lx.version)
+	lx.start, lx.pos, lx.lastPos, lx.line = pos, pos, pos, line
+}
+
+// isTopLevelLine reports if the line looks like the start of a [table] or
+// [[array]] header (possibly without the closing ']') or a key/value pair.
+func isTopLevelLine(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	if strings.HasPrefix(line, "[") {
+		line = strings.TrimPrefix(line[1:], "[")
+		n := scanKey(line)
+		return n > 0 && (n == len(line) || line[n] == ']' || line[n] == '\r')
+	}
+	n := scanKey(line)
+	return n > 0 && n < len(line) && line[n] == '='
+}
+
+// scanKey gets the length of the (possibly dotted) key at the start of s,
+// including any whitespace after it. It doesn't check if the key is valid.
+func scanKey(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				return 0
+			}
+			i += end + 1
+		case c != '.' && !isWhitespace(rune(c)) && !isBareKeyChar(rune(c)):
+			return i
+		}
+	}
+	return len(s)
+}
+
 func (lx *lexer) push(state stateFn) {
 	lx.stack = append(lx.stack, state)
 }
@@ -128,19 +192,41 @@ func (lx *lexer) current() string {
 }
 
 func (lx *lexer) emit(typ itemType) {
-	lx.items <- item{typ, lx.current(), lx.line}
+	lx.items <- item{typ: typ, val: lx.current(), pos: lx.getPos(lx.start, lx.pos)}
 	lx.start = lx.pos
 }
 
 func (lx *lexer) emitTrim(typ itemType) {
-	lx.items <- item{typ, strings.TrimSpace(lx.current()), lx.line}
+	val := strings.TrimSpace(lx.current())
+	start := lx.start + strings.Index(lx.current(), val)
+	lx.items <- item{typ: typ, val: val, pos: lx.getPos(start, start+len(val))}
 	lx.start = lx.pos
 }
 
+// getPos gets the Position of input[start:end].
+func (lx *lexer) getPos(start, end int) Position {
+	// lx.line is the line of lx.pos, so count from there rather than from the
+	// start of the input.
+	line := lx.line
+	if start <= lx.pos {
+		line -= strings.Count(lx.input[start:lx.pos], "\n")
+	} else {
+		line += strings.Count(lx.input[lx.pos:start], "\n")
+	}
+	lineStart := strings.LastIndexByte(lx.input[:start], '\n') + 1
+	return Position{
+		Line:  line,
+		Col:   utf8.RuneCountInString(lx.input[lineStart:start]) + 1,
+		Start: start,
+		Len:   end - start,
+	}
+}
+
 func (lx *lexer) next() (r rune) {
 	if lx.atEOF {
 		panic("next called after EOF")
 	}
+	lx.lastPos = lx.pos
 	if lx.pos >= len(lx.input) {
 		lx.atEOF = true
 		return eof
@@ -158,7 +244,8 @@ func (lx *lexer) next() (r rune) {
 
 	r, w := utf8.DecodeRuneInString(lx.input[lx.pos:])
 	if r == utf8.RuneError {
-		lx.errorf("invalid UTF-8 byte at position %d (line %d): 0x%02x", lx.pos, lx.line, lx.input[lx.pos])
+		lx.errorErrf(ErrInvalidUTF8, "invalid UTF-8 byte at position %d (line %d): 0x%02x",
+			lx.pos, lx.line, lx.input[lx.pos])
 		return utf8.RuneError
 	}
 
@@ -224,11 +311,21 @@ func (lx *lexer) skip(pred func(rune) bool) {
 // errorf stops all lexing by emitting an error and returning `nil`.
 // Note that any value that is a character is escaped if it's a special
 // character (newlines, tabs, etc.).
+//
+// The error is positioned at the last rune that was read (or peeked at).
 func (lx *lexer) errorf(format string, values ...interface{}) stateFn {
+	return lx.errorErrf(ErrSyntax, format, values...)
+}
+
+// errorErrf is like errorf, but with a different sentinel error than
+// ErrSyntax.
+func (lx *lexer) errorErrf(err error, format string, values ...interface{}) stateFn {
+	_, w := utf8.DecodeRuneInString(lx.input[lx.lastPos:])
 	lx.items <- item{
-		itemError,
-		fmt.Sprintf(format, values...),
-		lx.line,
+		typ: itemError,
+		val: fmt.Sprintf(format, values...),
+		pos: lx.getPos(lx.lastPos, lx.lastPos+w),
+		err: err,
 	}
 	return nil
 }
@@ -362,8 +459,7 @@ func lexTableNameEnd(lx *lexer) stateFn {
 	}
 }
 
-// lexKeyStart consumes a key name up until the first non-whitespace character.
-// lexKeyStart will ignore whitespace.
+// lexKeyStart consumes all key parts until a '='.
 func lexKeyStart(lx *lexer) stateFn {
 	r := lx.peek()
 	switch {
@@ -372,25 +468,33 @@ func lexKeyStart(lx *lexer) stateFn {
 	case isWhitespace(r) || isNL(r):
 		lx.next()
 		return lexSkip(lx, lexKeyStart)
+	}
+
+	lx.ignore()
+	lx.emit(itemKeyStart)
+	return lexKeyNameStart
+}
+
+// lexKeyNameStart consumes one part of a key; this is either a bare key or a
+// quoted string. Keys can be dotted (e.g. 'a.b.c'), in which case this state
+// is entered once for every part.
+func lexKeyNameStart(lx *lexer) stateFn {
+	lx.skip(isWhitespace)
+	switch r := lx.peek(); {
+	case r == keySep || r == tableSep:
+		return lx.errorf("unexpected %q (keys cannot be empty)", r)
+	case r == eof:
+		return lx.errorf("unexpected EOF; expected key separator %q", keySep)
 	case r == stringStart || r == rawStringStart:
+		lx.next()
 		lx.ignore()
-		lx.emit(itemKeyStart)
 		lx.push(lexKeyEnd)
-
-		r := lx.next()
-		lx.ignore()
-		switch r {
-		case stringStart:
+		if r == stringStart {
 			return lexString
-		case rawStringStart:
-			return lexRawString
-		default:
-			lx.errorf("keys must be string")
 		}
-		return lexValue
+		return lexRawString
 	default:
 		lx.ignore()
-		lx.emit(itemKeyStart)
 		return lexBareKey
 	}
 }
@@ -401,11 +505,7 @@ func lexBareKey(lx *lexer) stateFn {
 	switch r := lx.next(); {
 	case isBareKeyChar(r):
 		return lexBareKey
-	case isWhitespace(r):
-		lx.backup()
-		lx.emit(itemText)
-		return lexKeyEnd
-	case r == keySep:
+	case isWhitespace(r), r == keySep, r == tableSep:
 		lx.backup()
 		lx.emit(itemText)
 		return lexKeyEnd
@@ -416,12 +516,17 @@ func lexBareKey(lx *lexer) stateFn {
 	}
 }
 
-// lexKeyEnd consumes the end of a key and trims whitespace (up to the key
-// separator).
+// lexKeyEnd consumes the end of a key part and trims whitespace (up to the
+// key separator or the separator of a dotted key).
 func lexKeyEnd(lx *lexer) stateFn {
 	switch r := lx.next(); {
 	case r == keySep:
+		lx.ignore()
+		lx.emit(itemKeyEnd)
 		return lexSkip(lx, lexValue)
+	case r == tableSep:
+		lx.ignore()
+		return lexKeyNameStart
 	case isWhitespace(r):
 		return lexSkip(lx, lexKeyEnd)
 	case r == eof:
@@ -448,11 +553,9 @@ func lexValue(lx *lexer) stateFn {
 	}
 	switch r {
 	case arrayStart:
-		lx.ignore()
 		lx.emit(itemArray)
 		return lexArrayValue
 	case inlineTableStart:
-		lx.ignore()
 		lx.emit(itemInlineTableStart)
 		return lexInlineTableValue
 	case stringStart:
@@ -547,19 +650,22 @@ func lexArrayValueEnd(lx *lexer) stateFn {
 // lexArrayEnd finishes the lexing of an array.
 // It assumes that a ']' has just been consumed.
 func lexArrayEnd(lx *lexer) stateFn {
-	lx.ignore()
 	lx.emit(itemArrayEnd)
 	return lx.pop()
 }
 
 // lexInlineTableValue consumes one key/value pair in an inline table.
-// It assumes that '{' or ',' have already been consumed. Whitespace is ignored.
+// It assumes that '{' or ',' have already been consumed. Whitespace is ignored,
+// and so are newlines in TOML 1.1.
 func lexInlineTableValue(lx *lexer) stateFn {
 	r := lx.next()
 	switch {
 	case isWhitespace(r):
 		return lexSkip(lx, lexInlineTableValue)
 	case isNL(r):
+		if lx.version >= V1_1Draft {
+			return lexSkip(lx, lexInlineTableValue)
+		}
 		return lx.errorf("newlines not allowed within inline tables")
 	case r == commentStart:
 		lx.push(lexInlineTableValue)
@@ -577,18 +683,29 @@ func lexInlineTableValue(lx *lexer) stateFn {
 // lexInlineTableValueEnd consumes everything between the end of an inline table
 // key/value pair and the next pair (or the end of the table):
 // it ignores whitespace and expects either a ',' or a '}'.
+//
+// TOML 1.1 also allows newlines and a trailing comma.
 func lexInlineTableValueEnd(lx *lexer) stateFn {
 	r := lx.next()
 	switch {
 	case isWhitespace(r):
 		return lexSkip(lx, lexInlineTableValueEnd)
 	case isNL(r):
+		if lx.version >= V1_1Draft {
+			return lexSkip(lx, lexInlineTableValueEnd)
+		}
 		return lx.errorf("newlines not allowed within inline tables")
 	case r == commentStart:
 		lx.push(lexInlineTableValueEnd)
 		return lexCommentStart
 	case r == comma:
 		lx.ignore()
+		if lx.version < V1_1Draft {
+			lx.skip(isWhitespace)
+			if lx.peek() == inlineTableEnd {
+				return lx.errorf("trailing comma not allowed in inline tables")
+			}
+		}
 		return lexInlineTableValue
 	case r == inlineTableEnd:
 		return lexInlineTableEnd
@@ -608,7 +725,6 @@ func runeOrEOF(r rune) string {
 // lexInlineTableEnd finishes the lexing of an inline table.
 // It assumes that a '}' has just been consumed.
 func lexInlineTableEnd(lx *lexer) stateFn {
-	lx.ignore()
 	lx.emit(itemInlineTableEnd)
 	return lx.pop()
 }
@@ -781,12 +897,37 @@ func lexStringEscape(lx *lexer) stateFn {
 		return lexShortUnicodeEscape
 	case 'U':
 		return lexLongUnicodeEscape
+	case 'e':
+		if lx.version >= V1_1Draft {
+			return lx.pop()
+		}
+	case 'x':
+		if lx.version >= V1_1Draft {
+			return lexHexEscape
+		}
+	}
+	if lx.version >= V1_1Draft {
+		return lx.errorf("invalid escape character %q; only the following "+
+			"escape characters are allowed: "+
+			`\b, \t, \n, \f, \r, \e, \", \\, \xXX, \uXXXX, and \UXXXXXXXX`, r)
 	}
 	return lx.errorf("invalid escape character %q; only the following "+
 		"escape characters are allowed: "+
 		`\b, \t, \n, \f, \r, \", \\, \uXXXX, and \UXXXXXXXX`, r)
 }
 
+func lexHexEscape(lx *lexer) stateFn {
+	var r rune
+	for i := 0; i < 2; i++ {
+		r = lx.next()
+		if !isHexadecimal(r) {
+			return lx.errorf(`expected two hexadecimal digits after '\x', `+
+				"but got %q instead", lx.current())
+		}
+	}
+	return lx.pop()
+}
+
 func lexShortUnicodeEscape(lx *lexer) stateFn {
 	var r rune
 	for i := 0; i < 4; i++ {
@@ -1066,11 +1207,23 @@ func lexCommentStart(lx *lexer) stateFn {
 // lexComment lexes an entire comment. It assumes that '#' has been consumed.
 // It will consume *up to* the first newline character, and pass control
 // back to the last state on the stack.
+//
+// Control characters are not allowed in TOML 1.0 comments; TOML 0.4 didn't
+// have this rule and TOML 1.1 relaxes it again.
 func lexComment(lx *lexer) stateFn {
-	r := lx.peek()
-	if isNL(r) || r == eof {
+	switch r := lx.peek(); {
+	case r == '\r' && lx.version == V1_0:
+		lx.next()
+		if lx.peek() != '\n' {
+			return lx.errorf("control characters are not allowed inside comments: '0x%02x'", r)
+		}
+		lx.backup()
+		fallthrough
+	case isNL(r) || r == eof:
 		lx.emit(itemText)
 		return lx.pop()
+	case isControl(r) && lx.version == V1_0:
+		return lx.errorf("control characters are not allowed inside comments: '0x%02x'", r)
 	}
 	lx.next()
 	return lexComment
@@ -1162,6 +1315,8 @@ func (itype itemType) String() string {
 		return "TableEnd"
 	case itemKeyStart:
 		return "KeyStart"
+	case itemKeyEnd:
+		return "KeyEnd"
 	case itemArray:
 		return "Array"
 	case itemArrayEnd:
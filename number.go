@@ -0,0 +1,86 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Number is a TOML integer or float as it's written in the document, such as
+// "0xDEAD_BEEF", "1e400", or "3.14159265358979323846264338".
+//
+// Decoding in to a Number keeps the exact text of the value, which is also
+// written as-is by the encoder. Use Decoder.UseNumber to get a Number rather
+// than an int64 or float64 when decoding in to an interface{}.
+type Number string
+
+// String returns the literal text of the number.
+func (n Number) String() string { return string(n) }
+
+// Int64 returns the number as an int64.
+//
+// This is an error that matches ErrTypeMismatch if the number is a float, or
+// ErrOutOfRange if it doesn't fit in an int64.
+func (n Number) Int64() (int64, error) {
+	if n.isFloat() {
+		return 0, kindError{ErrTypeMismatch, fmt.Sprintf("number %s is a float, not an integer", n)}
+	}
+	i, err := strconv.ParseInt(string(n), 0, 64)
+	if err != nil {
+		return 0, numberError(n, "64-bit signed integers", err)
+	}
+	return i, nil
+}
+
+// Float64 returns the number as a float64; integers are converted to a
+// float64.
+//
+// This is an error that matches ErrOutOfRange if the number doesn't fit in a
+// float64.
+func (n Number) Float64() (float64, error) {
+	if !n.isFloat() {
+		i, err := n.Int64()
+		return float64(i), err
+	}
+	s := strings.Replace(string(n), "_", "", -1)
+	if s == "+nan" || s == "-nan" { // Go doesn't support this, but TOML spec does.
+		s = "nan"
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, numberError(n, "64-bit IEEE-754 floating-point numbers", err)
+	}
+	return f, nil
+}
+
+// value returns the number as an int64 or float64.
+func (n Number) value() (interface{}, error) {
+	if n.isFloat() {
+		return n.Float64()
+	}
+	return n.Int64()
+}
+
+// valid reports if n is an integer or float as it's written in TOML, with the
+// same rules as for a value in a document.
+func (n Number) valid() bool {
+	p, err := parseDocument("n = "+string(n), defaultDecoder)
+	return err == nil && p.mapping["n"] == n
+}
+
+// isFloat reports if the number is written as a float.
+func (n Number) isFloat() bool {
+	s := strings.TrimLeft(string(n), "+-")
+	if len(s) > 1 && s[0] == '0' && strings.ContainsRune("xob", rune(s[1])) {
+		return false
+	}
+	return strings.ContainsAny(s, ".eEn") // "n" for inf and nan.
+}
+
+func numberError(n Number, what string, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return kindError{ErrOutOfRange, fmt.Sprintf("number %s is out of the range of %s", n, what)}
+	}
+	return kindError{ErrSyntax, fmt.Sprintf("invalid number %q", n)}
+}
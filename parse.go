@@ -10,9 +10,11 @@ import (
 )
 
 type parser struct {
-	mapping map[string]interface{}
-	types   map[string]tomlType
-	lx      *lexer
+	mapping   map[string]interface{}
+	types     map[string]tomlType
+	positions map[string]Position
+	lx        *lexer
+	version   Version
 
 	// A list of keys in the order that they appear in the TOML data.
 	ordered []Key
@@ -23,27 +25,58 @@ type parser struct {
 	// the base key name for everything except hashes
 	currentKey string
 
-	// rough approximation of line number
-	approxLine int
+	// position of the item that's being parsed; used for errors.
+	pos Position
 
 	// A map of 'key.group.names' to whether they were created implicitly.
 	implicits map[string]bool
-}
 
-// ParseError is used when a file can't be parsed: for example invalid integer
-// literals, duplicate keys, etc.
-type ParseError struct {
-	Message string
-	Line    int
-	LastKey string
+	// A map of 'key.group.names' to whether they were created by a dotted
+	// key. These tables can be extended by other dotted keys in the same
+	// table, but can't be defined again with a [table] header.
+	dotted map[string]bool
+
+	// A map of 'key.group.names' to whether they're an inline table. These
+	// can't be extended, except in TOML 0.4.
+	inline map[string]bool
+
+	// If set, errors are collected in errors and parsing continues on the next
+	// line that looks like a key/value pair or table header.
+	allErrors bool
+	errors    ParseErrors
+
+	limits     Limits
+	nkeys      int // Number of keys and tables, for limits.MaxKeys.
+	arrayDepth int // Nesting of arrays, for limits.MaxDepth.
+
+	// Looks up environment variables in basic strings; nil if they're not
+	// expanded.
+	lookupEnv func(string) (string, bool)
+	refs      bool        // Expand references to other keys in basic strings.
+	templates []*template // Basic strings to expand, in document order.
+	expanding []*template // Templates being expanded, to detect cycles.
+
+	// Name of the file, for errors in included files; the key/file map has
+	// the file every key is from if files were included.
+	file  string
+	files map[string]string
 }
 
-func (pe ParseError) Error() string {
-	return fmt.Sprintf("Near line %d (last key parsed '%s'): %s",
-		pe.Line, pe.LastKey, pe.Message)
+// parse parses the TOML data with the options from the Decoder; with AllErrors
+// it returns ParseErrors with all the errors in the document, rather than the
+// first ParseError.
+func parse(data string, dec *Decoder) (*parser, error) {
+	p, err := parseDocument(data, dec)
+	if err != nil {
+		return nil, err
+	}
+	return p, p.expandTemplates()
 }
 
-func parse(data string) (p *parser, err error) {
+// parseDocument is like parse, but doesn't expand the templates. This is done
+// after all the included files are merged, so that they can refer to each
+// other.
+func parseDocument(data string, dec *Decoder) (p *parser, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			var ok bool
@@ -68,41 +101,85 @@ func parse(data string) (p *parser, err error) {
 		ex = len(data)
 	}
 	if strings.ContainsRune(data[:ex], 0) {
-		return nil, errors.New("files cannot contain NULL bytes; probably using UTF-16; TOML files must be UTF-8")
+		return nil, kindError{ErrInvalidUTF8,
+			"files cannot contain NULL bytes; probably using UTF-16; TOML files must be UTF-8"}
 	}
 
 	p = &parser{
 		mapping:   make(map[string]interface{}),
 		types:     make(map[string]tomlType),
-		lx:        lex(data),
+		positions: make(map[string]Position),
+		lx:        lex(data, dec.version),
+		version:   dec.version,
 		ordered:   make([]Key, 0),
 		implicits: make(map[string]bool),
+		dotted:    make(map[string]bool),
+		inline:    make(map[string]bool),
+		allErrors: dec.allErrors,
+		limits:    dec.limits,
+		lookupEnv: dec.lookupEnv,
+		refs:      dec.refs,
 	}
-	for {
-		item := p.next()
-		if item.typ == itemEOF {
-			break
-		}
-		p.topLevel(item)
+	for p.parseNext() {
 	}
 
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
 	return p, nil
 }
 
+// parseNext parses the next top-level item, returning false on EOF.
+//
+// If allErrors is set then a ParseError is recorded and the lexer is
+// resynchronized, rather than aborting the parse.
+func (p *parser) parseNext() (more bool) {
+	context := p.context
+	defer func() {
+		if r := recover(); r != nil {
+			pErr, ok := r.(ParseError)
+			if !ok || !p.allErrors {
+				panic(r)
+			}
+			p.errors = append(p.errors, pErr)
+			p.context, p.currentKey = context, ""
+			p.lx.resync()
+			more = true
+		}
+	}()
+
+	item := p.next()
+	if item.typ == itemEOF {
+		return false
+	}
+	p.topLevel(item)
+	return true
+}
+
 func (p *parser) panicf(format string, v ...interface{}) {
+	p.panicErrf(ErrSyntax, format, v...)
+}
+
+// panicErrf is like panicf, but the ParseError wraps the given error (usually
+// one of the Err* sentinels) instead of ErrSyntax.
+func (p *parser) panicErrf(err error, format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
 	panic(ParseError{
-		Message: msg,
-		Line:    p.approxLine,
-		LastKey: p.current(),
+		Message:  msg,
+		Position: p.pos,
+		Line:     p.pos.Line,
+		LastKey:  p.current(),
+		input:    p.lx.input,
+		err:      err,
 	})
 }
 
 func (p *parser) next() item {
 	it := p.lx.nextItem()
-	//fmt.Printf("ITEM %-18s line %-3d → %q\n", it.typ, it.line, it.val)
+	//fmt.Printf("ITEM %-18s line %-3d → %q\n", it.typ, it.pos.Line, it.val)
+	p.pos = it.pos
 	if it.typ == itemError {
-		p.panicf("%s", it.val)
+		p.panicErrf(it.err, "%s", it.val)
 	}
 	return it
 }
@@ -126,55 +203,103 @@ func (p *parser) assertEqual(expected, got itemType) {
 func (p *parser) topLevel(item item) {
 	switch item.typ {
 	case itemCommentStart:
-		p.approxLine = item.line
 		p.expect(itemText)
 	case itemTableStart:
 		kg := p.next()
-		p.approxLine = kg.line
+		first, last := kg.pos, kg.pos
 
 		var key Key
 		for ; kg.typ != itemTableEnd && kg.typ != itemEOF; kg = p.next() {
 			key = append(key, p.keyString(kg))
+			last = kg.pos
 		}
 		p.assertEqual(itemTableEnd, kg.typ)
 
+		p.pos = span(first, last)
 		p.establishContext(key, false)
-		p.setType("", tomlHash)
+		p.setType("", tomlHash, p.pos)
 		p.ordered = append(p.ordered, key)
 	case itemArrayTableStart:
 		kg := p.next()
-		p.approxLine = kg.line
+		first, last := kg.pos, kg.pos
 
 		var key Key
 		for ; kg.typ != itemArrayTableEnd && kg.typ != itemEOF; kg = p.next() {
 			key = append(key, p.keyString(kg))
+			last = kg.pos
 		}
 		p.assertEqual(itemArrayTableEnd, kg.typ)
 
+		p.pos = span(first, last)
 		p.establishContext(key, true)
-		p.setType("", tomlArrayHash)
+		p.setType("", tomlArrayHash, p.pos)
 		p.ordered = append(p.ordered, key)
 	case itemKeyStart:
-		kname := p.next()
-		p.approxLine = kname.line
-		p.currentKey = p.keyString(kname)
+		outerContext := p.context
+
+		// For dotted keys ('a.b.c = 1') the last part is the key we set, and
+		// all the other parts are tables in the current context.
+		key := p.key()
+		keyPos := p.pos
+		p.currentKey = ""
+		p.establishDotted(key[:len(key)-1])
+		p.currentKey = key[len(key)-1]
 
-		val, typ := p.value(p.next())
+		it := p.next()
+		val, typ := p.value(it)
+		p.pos = keyPos
 		p.setValue(p.currentKey, val)
-		p.setType(p.currentKey, typ)
+		p.setType(p.currentKey, typ, it.pos)
 		p.ordered = append(p.ordered, p.context.add(p.currentKey))
+		if it.typ == itemInlineTableStart {
+			p.inline[p.context.add(p.currentKey).String()] = true
+		}
+		p.context = outerContext
 		p.currentKey = ""
 	default:
 		p.bug("Unexpected type at top level: %s", item.typ)
 	}
 }
 
+// key reads all the parts of a key, up to and including the itemKeyEnd.
+//
+// Afterwards p.pos is the position of the entire key, for errors.
+func (p *parser) key() Key {
+	var (
+		key         Key
+		first, last Position
+	)
+	for it := p.next(); it.typ != itemKeyEnd; it = p.next() {
+		if len(key) == 0 {
+			first = it.pos
+		}
+		last = it.pos
+		key = append(key, p.keyString(it))
+
+		// Only used for error messages if the key or value is invalid.
+		p.currentKey = key.String()
+	}
+	p.pos = span(first, last)
+	if len(key) > 1 && p.version < V1_0 {
+		p.panicf("Dotted keys are not allowed in %s.", p.version)
+	}
+	return key
+}
+
+// span gets the Position from the start of first to the end of last.
+func span(first, last Position) Position {
+	first.Len = last.Start + last.Len - first.Start
+	return first
+}
+
 // Gets a string for a key (or part of a key in a table name).
 func (p *parser) keyString(it item) string {
 	switch it.typ {
 	case itemText:
 		return it.val
-	case itemString, itemMultilineString,
+	case itemString: // Not p.value(), as variables in keys aren't expanded.
+		return p.replaceEscapes(it.val)
+	case itemMultilineString,
 		itemRawString, itemRawMultilineString:
 		s, _ := p.value(it)
 		return s.(string)
@@ -194,10 +319,10 @@ var datetimeRepl = strings.NewReplacer(
 func (p *parser) value(it item) (interface{}, tomlType) {
 	switch it.typ {
 	case itemString:
-		return p.replaceEscapes(it.val), p.typeOfPrimitive(it)
+		return p.basicString(p.replaceEscapes(it.val)), p.typeOfPrimitive(it)
 	case itemMultilineString:
 		trimmed := stripFirstNewline(stripEscapedNewlines(it.val))
-		return p.replaceEscapes(trimmed), p.typeOfPrimitive(it)
+		return p.basicString(p.replaceEscapes(trimmed)), p.typeOfPrimitive(it)
 	case itemRawString:
 		return it.val, p.typeOfPrimitive(it)
 	case itemRawMultilineString:
@@ -218,25 +343,22 @@ func (p *parser) value(it item) (interface{}, tomlType) {
 		if numHasLeadingZero(it.val) {
 			p.panicf("Invalid integer %q: cannot have leading zeroes", it.val)
 		}
+		if p.version < V1_0 && len(it.val) > 1 && it.val[0] == '0' && strings.ContainsRune("xob", rune(it.val[1])) {
+			p.panicf("Invalid integer %q: hexadecimal, octal, and binary integers are not allowed in %s",
+				it.val, p.version)
+		}
 
-		num, err := strconv.ParseInt(it.val, 0, 64)
-		if err != nil {
-			// Distinguish integer values. Normally, it'd be a bug if the lexer
-			// provides an invalid integer, but it's possible that the number is
-			// out of range of valid values (which the lexer cannot determine).
-			// So mark the former as a bug but the latter as a legitimate user
-			// error.
-			if e, ok := err.(*strconv.NumError); ok &&
-				e.Err == strconv.ErrRange {
-
-				p.panicf("Integer '%s' is out of the range of 64-bit "+
-					"signed integers.", it.val)
-			} else {
-				p.bug("Expected integer value, but got '%s'.", it.val)
-			}
+		// Out of range integers are an error when decoding, as they may be
+		// decoded in to a Number.
+		num := Number(it.val)
+		if _, err := num.Int64(); err != nil && !errors.Is(err, ErrOutOfRange) {
+			p.bug("Expected integer value, but got '%s'.", it.val)
 		}
 		return num, p.typeOfPrimitive(it)
 	case itemFloat:
+		if p.version < V1_0 && (strings.HasSuffix(it.val, "inf") || strings.HasSuffix(it.val, "nan")) {
+			p.panicf("Invalid float %q: inf and nan are not allowed in %s", it.val, p.version)
+		}
 		parts := strings.FieldsFunc(it.val, func(r rune) bool {
 			switch r {
 			case '.', 'e', 'E':
@@ -259,47 +381,69 @@ func (p *parser) value(it item) (interface{}, tomlType) {
 			// part consists of '.' followed by 1+ digits.
 			p.panicf("Invalid float %q: '.' must be followed by one or more digits", it.val)
 		}
-		val := strings.Replace(it.val, "_", "", -1)
-		if val == "+nan" || val == "-nan" { // Go doesn't support this, but TOML spec does.
-			val = "nan"
-		}
-		num, err := strconv.ParseFloat(val, 64)
-		if err != nil {
-			if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
-				p.panicf("Float '%s' is out of the range of 64-bit IEEE-754 floating-point numbers.", it.val)
-			} else {
-				p.panicf("Invalid float value: %q", it.val)
-			}
+		num := Number(it.val)
+		if _, err := num.Float64(); err != nil && !errors.Is(err, ErrOutOfRange) {
+			p.panicf("Invalid float value: %q", it.val)
 		}
 		return num, p.typeOfPrimitive(it)
 	case itemDatetime:
+		if p.version < V1_0 && strings.ContainsRune(it.val, ' ') {
+			p.panicf("Invalid TOML Datetime %q: a space between the date and time is not allowed in %s",
+				it.val, p.version)
+		}
 		it.val = datetimeRepl.Replace(it.val)
 
-		var (
-			t   time.Time
-			ok  bool
-			err error
-		)
-		for _, format := range []string{
-			time.RFC3339Nano,
-			"2006-01-02T15:04:05.999999999",
-			"2006-01-02",
-			"15:04:05.999999999",
-		} {
-			t, err = time.ParseInLocation(format, it.val, time.Local)
-			if err == nil {
-				ok = true
-				break
+		// Datetimes without an offset are "local" and have no relation to a
+		// timezone, so they get their own types rather than a time.Time in
+		// some arbitrary location.
+		formats := []struct {
+			format string
+			typ    tomlType
+		}{
+			{time.RFC3339Nano, tomlDatetime},
+			{localDatetimeFormat, tomlLocalDatetime},
+			{localDateFormat, tomlLocalDate},
+			{localTimeFormat, tomlLocalTime},
+		}
+		if p.version >= V1_1Draft {
+			// The seconds are optional in TOML 1.1.
+			formats = append(formats, []struct {
+				format string
+				typ    tomlType
+			}{
+				{"2006-01-02T15:04Z07:00", tomlDatetime},
+				{"2006-01-02T15:04", tomlLocalDatetime},
+				{"15:04", tomlLocalTime},
+			}...)
+		}
+		for _, dt := range formats {
+			t, err := time.Parse(dt.format, it.val)
+			if err != nil {
+				continue
 			}
+			if p.version < V1_0 && dt.typ != tomlDatetime {
+				p.panicf("Invalid TOML Datetime %q: local dates and times are not allowed in %s",
+					it.val, p.version)
+			}
+			switch dt.typ {
+			case tomlLocalDatetime:
+				return LocalDatetimeOf(t), dt.typ
+			case tomlLocalDate:
+				return LocalDateOf(t), dt.typ
+			case tomlLocalTime:
+				return LocalTimeOf(t), dt.typ
+			}
+			return t, dt.typ
 		}
-		if !ok {
-			p.panicf("Invalid TOML Datetime: %q.", it.val)
-		}
-		return t, p.typeOfPrimitive(it)
+		p.panicf("Invalid TOML Datetime: %q.", it.val)
 	case itemArray:
 		array := make([]interface{}, 0)
 		types := make([]tomlType, 0)
 
+		p.arrayDepth++
+		defer func() { p.arrayDepth-- }()
+		p.checkDepth(len(p.context) + 1 + p.arrayDepth)
+
 		for it = p.next(); it.typ != itemArrayEnd; it = p.next() {
 			if it.typ == itemCommentStart {
 				p.expect(itemText)
@@ -318,26 +462,53 @@ func (p *parser) value(it item) (interface{}, tomlType) {
 			outerKey     = p.currentKey
 		)
 
-		p.context = append(p.context, p.currentKey)
+		p.context = p.context.add(p.currentKey)
 		p.currentKey = ""
+		tableContext := p.context
+		dotted := make(map[string]bool)
 		for it := p.next(); it.typ != itemInlineTableEnd; it = p.next() {
 			if it.typ == itemCommentStart {
 				p.expect(itemText)
 				continue
 			}
 
-			// retrieve key
-			k := p.next()
-			p.approxLine = k.line
-			kname := p.keyString(k)
+			// retrieve key; dotted keys create tables inside the inline table.
+			key := p.key()
+			p.currentKey = ""
+			h := hash
+			for i, k := range key[:len(key)-1] {
+				p.context = p.context.add(k)
+				partial := key[:i+1].String()
+				switch t := h[k].(type) {
+				case nil:
+					sub := make(map[string]interface{})
+					h[k] = sub
+					h = sub
+					dotted[partial] = true
+					p.setType("", tomlHash, p.pos)
+					p.ordered = append(p.ordered, p.context)
+				case map[string]interface{}:
+					if !dotted[partial] {
+						p.panicErrf(ErrDuplicateKey, "Key '%s' has already been defined.", p.context)
+					}
+					h = t
+				default:
+					p.panicErrf(ErrDuplicateKey, "Key '%s' has already been defined.", p.context)
+				}
+			}
+			p.currentKey = key[len(key)-1]
+			if _, ok := h[p.currentKey]; ok {
+				p.panicErrf(ErrDuplicateKey, "Key '%s' has already been defined.", p.current())
+			}
 
 			// retrieve value
-			p.currentKey = kname
-			val, typ := p.value(p.next())
+			it := p.next()
+			val, typ := p.value(it)
 			// make sure we keep metadata up to date
-			p.setType(kname, typ)
+			p.setType(p.currentKey, typ, it.pos)
 			p.ordered = append(p.ordered, p.context.add(p.currentKey))
-			hash[kname] = val
+			h[p.currentKey] = val
+			p.context = tableContext
 		}
 		p.context = outerContext
 		p.currentKey = outerKey
@@ -417,6 +588,13 @@ func (p *parser) establishContext(key Key, array bool) {
 			hashContext[k] = make(map[string]interface{})
 		}
 
+		// Inline tables are self-contained since TOML 0.5, and can't be
+		// extended by adding sub-tables.
+		if p.inline[keyContext.String()] && p.version >= V1_0 {
+			p.panicErrf(ErrDuplicateKey, "Key '%s' is an inline table and can't be extended.",
+				keyContext)
+		}
+
 		// If the hash context is actually an array of tables, then set
 		// the hash context to the last element in that array.
 		//
@@ -428,7 +606,7 @@ func (p *parser) establishContext(key Key, array bool) {
 		case map[string]interface{}:
 			hashContext = t
 		default:
-			p.panicf("Key '%s' was already created as a hash.", keyContext)
+			p.panicErrf(ErrDuplicateKey, "Key '%s' was already created as a hash.", keyContext)
 		}
 	}
 
@@ -446,7 +624,7 @@ func (p *parser) establishContext(key Key, array bool) {
 		if hash, ok := hashContext[k].([]map[string]interface{}); ok {
 			hashContext[k] = append(hash, make(map[string]interface{}))
 		} else {
-			p.panicf("Key '%s' was already created and cannot be used as "+
+			p.panicErrf(ErrDuplicateKey, "Key '%s' was already created and cannot be used as "+
 				"an array.", keyContext)
 		}
 	} else {
@@ -455,10 +633,45 @@ func (p *parser) establishContext(key Key, array bool) {
 	p.context = append(p.context, key[len(key)-1])
 }
 
-// setValue sets the given key to the given value in the current context.
-// It will make sure that the key hasn't already been defined, account for
-// implicit key groups.
-func (p *parser) setValue(key string, value interface{}) {
+// establishDotted adds the tables for the parts of a dotted key to the current
+// context, creating them if they don't exist yet.
+//
+// Tables created by a dotted key can be extended by other dotted keys, and so
+// can tables that were created implicitly by a [table] header. Anything else
+// (values, inline tables, arrays of tables and explicitly defined tables)
+// can't be.
+func (p *parser) establishDotted(parts Key) {
+	for _, k := range parts {
+		hash := p.contextHash()
+		keyContext := p.context.add(k)
+		switch hash[k].(type) {
+		case nil:
+			hash[k] = make(map[string]interface{})
+			p.dotted[keyContext.String()] = true
+			p.types[keyContext.String()] = tomlHash
+			p.setPosition(keyContext, p.pos)
+			p.ordered = append(p.ordered, keyContext)
+		case map[string]interface{}:
+			if p.isImplicit(keyContext) {
+				p.removeImplicit(keyContext)
+				p.dotted[keyContext.String()] = true
+				p.types[keyContext.String()] = tomlHash
+				p.setPosition(keyContext, p.pos)
+				p.ordered = append(p.ordered, keyContext)
+			}
+			if !p.dotted[keyContext.String()] {
+				p.panicErrf(ErrDuplicateKey, "Key '%s' has already been defined.", keyContext)
+			}
+		default:
+			p.panicErrf(ErrDuplicateKey, "Key '%s' has already been defined.", keyContext)
+		}
+		p.context = keyContext
+	}
+}
+
+// contextHash returns the hash for the current context; if the context is an
+// array of tables then this is the most recently defined table.
+func (p *parser) contextHash() map[string]interface{} {
 	var tmpHash interface{}
 	var ok bool
 
@@ -481,7 +694,15 @@ func (p *parser) setValue(key string, value interface{}) {
 				"it has '%T' instead.", tmpHash)
 		}
 	}
-	keyContext = append(keyContext, key)
+	return hash
+}
+
+// setValue sets the given key to the given value in the current context.
+// It will make sure that the key hasn't already been defined, account for
+// implicit key groups.
+func (p *parser) setValue(key string, value interface{}) {
+	hash := p.contextHash()
+	keyContext := p.context.add(key)
 
 	if _, ok := hash[key]; ok {
 		// Typically, if the given key has already been set, then we have
@@ -502,17 +723,17 @@ func (p *parser) setValue(key string, value interface{}) {
 
 		// Otherwise, we have a concrete key trying to override a previous
 		// key, which is *always* wrong.
-		p.panicf("Key '%s' has already been defined.", keyContext)
+		p.panicErrf(ErrDuplicateKey, "Key '%s' has already been defined.", keyContext)
 	}
 	hash[key] = value
 }
 
-// setType sets the type of a particular value at a given key.
+// setType sets the type and position of a particular value at a given key.
 // It should be called immediately AFTER setValue.
 //
 // Note that if `key` is empty, then the type given will be applied to the
 // current context (which is either a table or an array of tables).
-func (p *parser) setType(key string, typ tomlType) {
+func (p *parser) setType(key string, typ tomlType, pos Position) {
 	keyContext := make(Key, 0, len(p.context)+1)
 	for _, k := range p.context {
 		keyContext = append(keyContext, k)
@@ -521,6 +742,51 @@ func (p *parser) setType(key string, typ tomlType) {
 		keyContext = append(keyContext, key)
 	}
 	p.types[keyContext.String()] = typ
+	p.setPosition(keyContext, pos)
+
+	p.nkeys++
+	if p.limits.MaxKeys > 0 && p.nkeys > p.limits.MaxKeys {
+		p.panicErrf(ErrLimitExceeded, "document has more than %d keys", p.limits.MaxKeys)
+	}
+	p.checkDepth(len(keyContext) + p.arrayDepth)
+}
+
+// setPosition sets the position of a key. Keys in arrays of tables also get
+// the position with the index of the table, e.g. servers[1].host, as the
+// position without it is the position in the last table.
+func (p *parser) setPosition(key Key, pos Position) {
+	p.positions[key.String()] = pos
+
+	var (
+		b       strings.Builder
+		hash    = p.mapping
+		indexed bool
+	)
+	for i, k := range key {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(k)
+		switch t := hash[k].(type) {
+		case []map[string]interface{}:
+			fmt.Fprintf(&b, "[%d]", len(t)-1)
+			hash, indexed = t[len(t)-1], true
+		case map[string]interface{}:
+			hash = t
+		default:
+			hash = nil
+		}
+	}
+	if indexed {
+		p.positions[b.String()] = pos
+	}
+}
+
+// checkDepth checks the nesting depth against limits.MaxDepth.
+func (p *parser) checkDepth(depth int) {
+	if p.limits.MaxDepth > 0 && depth > p.limits.MaxDepth {
+		p.panicErrf(ErrLimitExceeded, "nesting is deeper than %d levels", p.limits.MaxDepth)
+	}
 }
 
 // addImplicit sets the given Key as having been created implicitly.
@@ -643,6 +909,16 @@ func (p *parser) replaceEscapes(str string) string {
 		case '\\':
 			replaced = append(replaced, rune(0x005C))
 			r += 1
+		case 'e':
+			replaced = append(replaced, rune(0x001B))
+			r += 1
+		case 'x':
+			// At this point, we know we have a hex escape of the form `xXX`
+			// at [r, r+3). (Because the lexer guarantees this for us, and
+			// only in TOML 1.1.)
+			escaped := p.asciiEscapeToUnicode(s[r+1 : r+3])
+			replaced = append(replaced, escaped)
+			r += 3
 		case 'u':
 			// At this point, we know we have a Unicode escape of the form
 			// `uXXXX` at [r, r+5). (Because the lexer guarantees this
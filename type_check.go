@@ -1,5 +1,7 @@
 package toml
 
+import "strings"
+
 // tomlType represents any Go type that corresponds to a TOML type.
 // While the first draft of the TOML spec has a simplistic type system that
 // probably doesn't need this level of sophistication, we seem to be militating
@@ -39,6 +41,10 @@ var (
 	tomlArray     tomlBaseType = "Array"
 	tomlHash      tomlBaseType = "Hash"
 	tomlArrayHash tomlBaseType = "ArrayHash"
+
+	tomlLocalDatetime tomlBaseType = "LocalDatetime"
+	tomlLocalDate     tomlBaseType = "LocalDate"
+	tomlLocalTime     tomlBaseType = "LocalTime"
 )
 
 // typeOfPrimitive returns a tomlType of any primitive value in TOML.
@@ -72,8 +78,10 @@ func (p *parser) typeOfPrimitive(lexItem item) tomlType {
 // typeOfArray returns a tomlType for an array given a list of types of its
 // values.
 //
-// In the current spec, if an array is homogeneous, then its type is always
-// "Array". If the array is not homogeneous, an error is generated.
+// Arrays can contain values of different types since TOML 1.0. If all the
+// values have the same type (or if there are no values) the type is always
+// "Array"; otherwise it's a tomlMixedArray with the types of every value.
+// An error is generated for arrays with different types in TOML 0.4.
 func (p *parser) typeOfArray(types []tomlType) tomlType {
 	// Empty arrays are cool.
 	if len(types) == 0 {
@@ -83,9 +91,29 @@ func (p *parser) typeOfArray(types []tomlType) tomlType {
 	theType := types[0]
 	for _, t := range types[1:] {
 		if !typeEqual(theType, t) {
-			p.panicf("Array contains values of type '%s' and '%s', but "+
-				"arrays must be homogeneous.", theType, t)
+			if p.version < V1_0 {
+				p.panicf("Array contains values of type '%s' and '%s', but "+
+					"arrays must be homogeneous in %s.", theType, t, p.version)
+			}
+			return tomlMixedArray(types)
 		}
 	}
 	return tomlArray
 }
+
+// tomlMixedArray is the type of an array with values of different types. The
+// type string lists the type of every value in order, for example
+// "Array(Integer, String, Hash)".
+type tomlMixedArray []tomlType
+
+func (t tomlMixedArray) typeString() string {
+	types := make([]string, len(t))
+	for i := range t {
+		types[i] = t[i].typeString()
+	}
+	return "Array(" + strings.Join(types, ", ") + ")"
+}
+
+func (t tomlMixedArray) String() string {
+	return t.typeString()
+}
@@ -18,6 +18,7 @@ type field struct {
 	tag   bool         // whether field has a `toml` tag
 	index []int        // represents the depth of an anonymous field
 	typ   reflect.Type // the type of the field
+	opts  tagOptions   // options from the struct tag
 }
 
 // byName sorts field by name, breaking ties with depth,
@@ -62,9 +63,10 @@ func (x byIndex) Less(i, j int) bool {
 }
 
 // typeFields returns a list of fields that TOML should recognize for the given
-// type. The algorithm is breadth-first search over the set of structs to
-// include - the top struct and then any reachable anonymous structs.
-func typeFields(t reflect.Type) []field {
+// type, using the struct tag tagName. The algorithm is breadth-first search over
+// the set of structs to include - the top struct and then any reachable
+// anonymous structs.
+func typeFields(t reflect.Type, tagName string) []field {
 	// Anonymous fields to explore at the current level and the next.
 	current := []field{}
 	next := []field{{typ: t}}
@@ -95,7 +97,7 @@ func typeFields(t reflect.Type) []field {
 				if sf.PkgPath != "" && !sf.Anonymous { // unexported
 					continue
 				}
-				opts := getOptions(sf.Tag)
+				opts := getOptions(sf.Tag.Get(tagName))
 				if opts.skip {
 					continue
 				}
@@ -116,7 +118,10 @@ func typeFields(t reflect.Type) []field {
 					if name == "" {
 						name = sf.Name
 					}
-					fields = append(fields, field{name, tagged, index, ft})
+					if d, ok := sf.Tag.Lookup("default"); ok {
+						opts.def = &d
+					}
+					fields = append(fields, field{name, tagged, index, ft, opts})
 					if count[f.typ] > 1 {
 						// If there were multiple instances, add a second,
 						// so that the annihilation code will see a duplicate.
@@ -211,15 +216,21 @@ func dominantField(fields []field) (field, bool) {
 	return fields[0], true
 }
 
+type fieldCacheKey struct {
+	typ     reflect.Type
+	tagName string
+}
+
 var fieldCache struct {
 	sync.RWMutex
-	m map[reflect.Type][]field
+	m map[fieldCacheKey][]field
 }
 
 // cachedTypeFields is like typeFields but uses a cache to avoid repeated work.
-func cachedTypeFields(t reflect.Type) []field {
+func cachedTypeFields(t reflect.Type, tagName string) []field {
+	key := fieldCacheKey{t, tagName}
 	fieldCache.RLock()
-	f := fieldCache.m[t]
+	f := fieldCache.m[key]
 	fieldCache.RUnlock()
 	if f != nil {
 		return f
@@ -227,16 +238,16 @@ func cachedTypeFields(t reflect.Type) []field {
 
 	// Compute fields without lock.
 	// Might duplicate effort but won't hold other computations back.
-	f = typeFields(t)
+	f = typeFields(t, tagName)
 	if f == nil {
 		f = []field{}
 	}
 
 	fieldCache.Lock()
 	if fieldCache.m == nil {
-		fieldCache.m = map[reflect.Type][]field{}
+		fieldCache.m = map[fieldCacheKey][]field{}
 	}
-	fieldCache.m[t] = f
+	fieldCache.m[key] = f
 	fieldCache.Unlock()
 	return f
 }
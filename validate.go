@@ -0,0 +1,198 @@
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// patterns is a cache of the compiled "pattern=" struct tag options.
+var patterns sync.Map // map[string]*regexp.Regexp
+
+// validateField checks the value of a field that was decoded against the
+// validation options in the struct tag: min, max, len, oneof, and pattern.
+//
+// Numbers are compared with min and max, and strings, slices, arrays, and maps
+// are checked by their length.
+func (md *MetaData) validateField(f *field, rv reflect.Value) error {
+	opts := f.opts
+	if opts.min == nil && opts.max == nil && opts.length == nil && opts.oneof == nil && opts.pattern == "" {
+		return nil
+	}
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		if err := md.checkLen(opts, rv); err != nil {
+			return err
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if err := md.checkRange(opts, rv); err != nil {
+			return err
+		}
+	default:
+		if opts.min != nil || opts.max != nil || opts.length != nil {
+			return md.errorf(ErrUnsupportedType, "min, max, and len can't be used for %s", rv.Type())
+		}
+	}
+
+	if opts.oneof != nil {
+		if s := fmt.Sprint(rv.Interface()); !oneOf(s, opts.oneof) {
+			return md.errorf(ErrValidation, "value %q is not one of %s", s, strings.Join(opts.oneof, ", "))
+		}
+	}
+
+	if opts.pattern != "" {
+		if rv.Kind() != reflect.String {
+			return md.errorf(ErrUnsupportedType, "pattern can't be used for %s", rv.Type())
+		}
+		re, err := compilePattern(opts.pattern)
+		if err != nil {
+			return md.errorf(ErrUnsupportedType, "invalid pattern %q in struct tag: %s", opts.pattern, err)
+		}
+		if !re.MatchString(rv.String()) {
+			return md.errorf(ErrValidation, "value %q doesn't match the pattern %q", rv.String(), opts.pattern)
+		}
+	}
+	return nil
+}
+
+func (md *MetaData) checkLen(opts tagOptions, rv reflect.Value) error {
+	n := rv.Len()
+	if rv.Kind() == reflect.String {
+		n = len([]rune(rv.String()))
+	}
+	limit := func(opt string, s *string) (int, error) {
+		l, err := strconv.Atoi(*s)
+		if err != nil {
+			return 0, md.errorf(ErrUnsupportedType, "invalid %s=%s in struct tag: not a length", opt, *s)
+		}
+		return l, nil
+	}
+
+	if opts.length != nil {
+		l, err := limit("len", opts.length)
+		if err != nil {
+			return err
+		}
+		if n != l {
+			return md.errorf(ErrValidation, "length %d is not %d", n, l)
+		}
+	}
+	if opts.min != nil {
+		l, err := limit("min", opts.min)
+		if err != nil {
+			return err
+		}
+		if n < l {
+			return md.errorf(ErrValidation, "length %d is less than the minimum of %d", n, l)
+		}
+	}
+	if opts.max != nil {
+		l, err := limit("max", opts.max)
+		if err != nil {
+			return err
+		}
+		if n > l {
+			return md.errorf(ErrValidation, "length %d is more than the maximum of %d", n, l)
+		}
+	}
+	return nil
+}
+
+func (md *MetaData) checkRange(opts tagOptions, rv reflect.Value) error {
+	if opts.length != nil {
+		return md.errorf(ErrUnsupportedType, "len can't be used for %s", rv.Type())
+	}
+
+	// cmp compares the value with the limit in the struct tag: -1 if it's
+	// smaller, 0 if it's equal, and 1 if it's larger.
+	cmp := func(opt, s string) (int, error) {
+		var (
+			c   int
+			err error
+		)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var l int64
+			if l, err = strconv.ParseInt(s, 10, 64); err == nil {
+				c = compare(rv.Int() < l, rv.Int() > l)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var l uint64
+			if l, err = strconv.ParseUint(s, 10, 64); err == nil {
+				c = compare(rv.Uint() < l, rv.Uint() > l)
+			}
+		default:
+			var l float64
+			if l, err = strconv.ParseFloat(s, 64); err == nil {
+				c = compare(rv.Float() < l, rv.Float() > l)
+			}
+		}
+		if err != nil {
+			return 0, md.errorf(ErrUnsupportedType, "invalid %s=%s in struct tag for %s", opt, s, rv.Type())
+		}
+		return c, nil
+	}
+
+	if opts.min != nil {
+		c, err := cmp("min", *opts.min)
+		if err != nil {
+			return err
+		}
+		if c < 0 {
+			return md.errorf(ErrValidation, "value %v is less than the minimum of %s", rv.Interface(), *opts.min)
+		}
+	}
+	if opts.max != nil {
+		c, err := cmp("max", *opts.max)
+		if err != nil {
+			return err
+		}
+		if c > 0 {
+			return md.errorf(ErrValidation, "value %v is more than the maximum of %s", rv.Interface(), *opts.max)
+		}
+	}
+	return nil
+}
+
+func oneOf(s string, list []string) bool {
+	for _, o := range list {
+		if s == o {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(less, more bool) int {
+	switch {
+	case less:
+		return -1
+	case more:
+		return 1
+	}
+	return 0
+}
+
+func compilePattern(p string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(p); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(p, re)
+	return re, nil
+}